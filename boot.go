@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time between the connectivity checks during BOOT_GRACE
+const bootGraceRetryInterval = 10 * time.Second
+
+// waitForBootGrace holds the first check while the system booted less
+// than BOOT_GRACE ago, until the IP echo service answers or the grace
+// period ends. Right after a reboot the network may not be up yet, and
+// without an RTC the clock may be wrong too, so the uptime is used.
+func waitForBootGrace(config PorkbunConfig) {
+	if config.BootGrace == 0 {
+		return
+	}
+
+	uptime, err := systemUptime()
+	if err != nil {
+		if config.Debug {
+			log.Printf("ignoring BOOT_GRACE: %v", err)
+		}
+		return
+	}
+
+	remaining := config.BootGrace - uptime
+	if remaining <= 0 {
+		return
+	}
+
+	log.Printf("booted %s ago, waiting up to %s for the network", uptime.Round(time.Second), remaining.Round(time.Second))
+	deadline := time.Now().Add(remaining)
+
+	for {
+		_, err := getPublicIP(config, ipFamily(config.RecordType))
+		if err == nil {
+			return
+		}
+
+		if time.Now().Add(bootGraceRetryInterval).After(deadline) {
+			log.Printf("the network is still not ready at the end of BOOT_GRACE: %v", err)
+			return
+		}
+
+		log.Printf("the network is not ready yet, retrying in %s: %v", bootGraceRetryInterval, err)
+		time.Sleep(bootGraceRetryInterval)
+	}
+}
+
+// systemUptime returns how long ago the system booted. It's only
+// available on Linux.
+func systemUptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, fmt.Errorf("error reading the uptime: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/uptime format")
+	}
+
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected /proc/uptime format: %w", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -6,7 +6,7 @@ VERSION="v0.0.1"
 OUTPUT_DIR="builds"
 
 # Compile configuration
-GO_BUILD_FLAGS=-ldflags="-s -w"
+GO_BUILD_FLAGS="-ldflags=-s -w -X main.version=$VERSION"
 COMPRESS_BINARIES=true
 GENERATE_CHECKSUMS=true
 
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Transport used by every HTTP client, replaced to record or replay
+// the interactions
+var httpTransport http.RoundTripper = http.DefaultTransport
+
+// Interaction is a recorded request and its response. Secrets are
+// replaced by REDACTED before being stored.
+type Interaction struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  string      `json:"request_body,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody string      `json:"response_body"`
+}
+
+// setupCassette installs a recording transport when RECORD_FILE is set
+// or a replaying one when REPLAY_FILE is set. A cassette recorded with
+// RECORD_FILE can be shared to reproduce a problem, it doesn't contain
+// the API keys or tokens.
+func setupCassette() error {
+	recordFile, replayFile := os.Getenv("RECORD_FILE"), os.Getenv("REPLAY_FILE")
+
+	switch {
+	case recordFile != "" && replayFile != "":
+		return fmt.Errorf("RECORD_FILE and REPLAY_FILE can't be used together")
+	case recordFile != "":
+		httpTransport = &recordingTransport{
+			next:    http.DefaultTransport,
+			path:    recordFile,
+			secrets: cassetteSecrets(),
+		}
+	case replayFile != "":
+		data, err := os.ReadFile(replayFile)
+		if err != nil {
+			return fmt.Errorf("error reading the cassette: %w", err)
+		}
+
+		transport := &replayingTransport{secrets: cassetteSecrets()}
+		if err := json.Unmarshal(data, &transport.interactions); err != nil {
+			return fmt.Errorf("error decoding the cassette: %w", err)
+		}
+		httpTransport = transport
+	}
+
+	return nil
+}
+
+// cassetteSecrets returns the values that must never end up in a
+// cassette. Values too short to be real keys are skipped, replacing
+// them would mangle the rest of the cassette.
+func cassetteSecrets() []string {
+	var secrets []string
+	for _, envVar := range configEnvVars {
+		if !envVar.Secret {
+			continue
+		}
+		if value := getSecret(envVar.Name); len(value) >= 6 {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+func redact(value string, secrets []string) string {
+	for _, secret := range secrets {
+		value = strings.ReplaceAll(value, secret, "REDACTED")
+	}
+	return value
+}
+
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return string(body), nil
+}
+
+// recordingTransport does the requests and appends every interaction to
+// the cassette file. The whole file is rewritten after each one, so it's
+// complete even if the process exits with log.Fatal.
+type recordingTransport struct {
+	next    http.RoundTripper
+	path    string
+	secrets []string
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(newLimitedBody(resp.Body, maxResponseBytes))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	header := http.Header{}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.interactions = append(t.interactions, Interaction{
+		Method:       req.Method,
+		URL:          redact(req.URL.String(), t.secrets),
+		RequestBody:  redact(requestBody, t.secrets),
+		StatusCode:   resp.StatusCode,
+		Header:       header,
+		ResponseBody: redact(string(responseBody), t.secrets),
+	})
+
+	data, err := json.MarshalIndent(t.interactions, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the cassette: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("error writing the cassette: %w", err)
+	}
+
+	return resp, nil
+}
+
+// replayingTransport answers the requests from a cassette without any
+// network access. Each request gets the first unused interaction with
+// the same method and URL.
+type replayingTransport struct {
+	secrets []string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+func (t *replayingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, err := readRequestBody(req); err != nil {
+		return nil, err
+	}
+
+	url := redact(req.URL.String(), t.secrets)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.used == nil {
+		t.used = make([]bool, len(t.interactions))
+	}
+
+	for i, interaction := range t.interactions {
+		if t.used[i] || interaction.Method != req.Method || interaction.URL != url {
+			continue
+		}
+		t.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+			StatusCode:    interaction.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Header,
+			Body:          io.NopCloser(strings.NewReader(interaction.ResponseBody)),
+			ContentLength: int64(len(interaction.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, errors.New("no recorded interaction for " + req.Method + " " + url)
+}
@@ -3,23 +3,61 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type PorkbunResponse struct {
 	Status  string   `json:"status"`
+	Message string   `json:"message"`
 	Records []Record `json:"records"`
+	// IP the request came from, only in the answer of ping
+	YourIP string `json:"yourIp"`
 }
 
 type Record struct {
-	Content string `json:"content"`
+	ID      flexString `json:"id"`
+	Name    string     `json:"name"`
+	Type    string     `json:"type"`
+	Content flexString `json:"content"`
+	TTL     flexString `json:"ttl"`
+	Prio    flexString `json:"prio"`
+}
+
+// flexString decodes a JSON string, number or null into a string, so
+// the records still decode if Porkbun changes the type of a field
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case string(data) == "null":
+		*f = ""
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = flexString(s)
+	default:
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("unexpected JSON value %s, expected a string or a number", data)
+		}
+		*f = flexString(n)
+	}
+	return nil
 }
 
 type PorkbunConfig struct {
@@ -30,6 +68,78 @@ type PorkbunConfig struct {
 	Domain     string
 	RecordName string
 	RecordType string
+
+	// ID of the AAAA record updated next to RecordID when RecordType is
+	// BOTH
+	RecordIDAAAA string
+	// IDs and names of the records updated instead of RecordID and
+	// RecordName, from PORKBUN_RECORD_IDS and PORKBUN_SUBDOMAINS
+	RecordIDs   []string
+	RecordNames []string
+	// Label of the record when the run updates several records, so the
+	// outputs of each record can be told apart; empty for a single one
+	RecordLabel string
+
+	// Optional template the record content is rendered from
+	ContentTemplate string
+	// Optional pattern the rendered content must match before writing it
+	ContentRegex string
+	// Optional pattern the current record content must match before
+	// it is overwritten
+	ExpectedCurrent string
+
+	// Whether a failed notification makes the run fail
+	FailOnNotifyError bool
+	// Whether to also send a desktop notification
+	DesktopNotify bool
+	// Order in which the notification channels are tried
+	NotifyOrder []string
+	// Minimum time between two notifications of a channel, by channel
+	NotifyCooldowns map[string]time.Duration
+	// Whether to print a one-line metrics summary at the end of the run
+	MetricsSummary bool
+	// File the metrics of the run are written to in OpenMetrics format
+	MetricsFile string
+	// Whether to log debugging details, like the duration of each request
+	Debug bool
+	// Whether the run is against the in-process mock
+	Mock bool
+	// Whether to only log what would change, without editing the record,
+	// notifying or saving the state
+	DryRun bool
+
+	// Largest response body read from any endpoint
+	MaxResponseBytes int64
+	// Times a Porkbun request is retried after a network error or a 5xx
+	MaxRetries int
+
+	// URLs of the IP echo services tried in order, for IPv4 and IPv6
+	IPProviders   []string
+	IPProvidersV6 []string
+	// Redirects the IP echo service is allowed to answer with
+	IPMaxRedirects int
+	// How long after boot to wait for the network before the first check
+	BootGrace time.Duration
+
+	// Ordered sources the current content of the record is taken from
+	CurrentIPSources []string
+
+	// Whether to edit the record even when it already has the content
+	ForceUpdate bool
+
+	// Whether to skip retrieving the record while the public IP matches
+	// the content cached in the state file
+	TrustCache bool
+	// How long the cached content is trusted without checking Porkbun
+	CacheTTL time.Duration
+
+	// Time between two checks in daemon mode, zero runs once
+	UpdateInterval time.Duration
+
+	// File where the last change and success times are kept
+	StateFile string
+	// Alert when the record hasn't been updated or confirmed for longer
+	MaxRecordAge time.Duration
 }
 
 type TwilioConfig struct {
@@ -48,14 +158,77 @@ func main() {
 	// Configuring logging
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	config := PorkbunConfig{
-		APIURL:     "https://api.porkbun.com/api/json/v3/dns/edit/",
-		APIKey:     os.Getenv("PORKBUN_API_KEY"),
-		SecretKey:  os.Getenv("PORKBUN_SECRET_KEY"),
-		RecordID:   os.Getenv("PORKBUN_RECORD_ID"),
-		Domain:     os.Getenv("PORKBUN_DOMAIN"),
-		RecordName: os.Getenv("PORKBUN_SUBDOMAIN"),
-		RecordType: "A",
+	testNotify := flag.Bool("test-notify", false, "send a test notification and exit")
+	export := flag.String("export", "", "print the effective config in the given format (env or flags) and exit")
+	showSecrets := flag.Bool("show-secrets", false, "include secrets in the -export output")
+	checkForUpdate := flag.Bool("check-update", false, "check GitHub for a newer release and exit")
+	mock := flag.Bool("mock", false, "run against an in-process fake Porkbun and IP service, without network")
+	dryRun := flag.Bool("dry-run", false, "log what would change without editing the record or notifying")
+	interval := flag.Duration("interval", 0, "keep running and check every interval (e.g. 5m) until SIGINT or SIGTERM")
+	mockIP := flag.String("mock-ip", "203.0.113.20", "public IP reported by the fake IP service, "+mockRecordContent+" simulates no change")
+	flag.Parse()
+
+	if *mock {
+		httpTransport = newMockTransport(*mockIP)
+	} else if err := setupCassette(); err != nil {
+		log.Fatalf("error in the configuration: %v", err)
+	}
+
+	if *checkForUpdate {
+		message, err := checkUpdate()
+		if err != nil {
+			log.Fatalf("error checking for updates: %v", err)
+		}
+		fmt.Println(message)
+		return
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("error in the configuration: %v", err)
+	}
+	if *interval != 0 {
+		config.UpdateInterval = *interval
+	}
+	if *dryRun {
+		config.DryRun = true
+	}
+
+	// Exported before the runtime overrides, so the output reproduces
+	// the configuration given by the user
+	if *export != "" {
+		if err := exportConfig(os.Stdout, *export, config, *showSecrets); err != nil {
+			log.Fatalf("error exporting the configuration: %v", err)
+		}
+		return
+	}
+
+	if *mock {
+		config = mockConfig(config)
+	}
+	if config.DryRun {
+		// The cache or DNS could be stale, a dry run reports what the
+		// record really has
+		config.CurrentIPSources = []string{"api"}
+	}
+
+	metrics.Debug = config.Debug
+	maxResponseBytes = config.MaxResponseBytes
+
+	if *testNotify {
+		// A test that reaches no channel proves nothing, strict mode
+		// must not pass it
+		if len(enabledChannels(config)) == 0 {
+			if config.FailOnNotifyError {
+				log.Fatalf("error sending the test notification: no notification channel is configured")
+			}
+			log.Printf("warning: no notification channel is configured, the test notification wasn't sent")
+			return
+		}
+		if err := notify(config, nil, "This is a test notification from the Porkbun IP updater"); err != nil {
+			log.Fatalf("error sending the test notification: %v", err)
+		}
+		return
 	}
 
 	// Validate the configuration
@@ -63,157 +236,622 @@ func main() {
 		log.Fatalf("error in the configuration: %v", err)
 	}
 
-	if err := updateDNSIfNeeded(config); err != nil {
+	waitForBootGrace(config)
+
+	if config.UpdateInterval > 0 {
+		runDaemon(config)
+		return
+	}
+
+	if err := runCycle(config); err != nil {
 		log.Fatalf("error updating the DNS: %v", err)
 	}
 }
 
-func updateDNSIfNeeded(config PorkbunConfig) error {
-	currentDNSIP, err := getCurrentDNSIP(config)
+// runCycle updates the DNS once and reports the metrics of the cycle
+func runCycle(config PorkbunConfig) error {
+	err := updateDNSIfNeeded(config)
+	if config.MetricsSummary {
+		fmt.Println(metrics.summary())
+	}
+	if config.MetricsFile != "" {
+		if metricsErr := metrics.writeOpenMetrics(config.MetricsFile, err); metricsErr != nil {
+			log.Printf("error writing the metrics: %v", metricsErr)
+		}
+	}
+	return err
+}
+
+// loadConfig builds the configuration from the environment variables
+func loadConfig() (PorkbunConfig, error) {
+	failOnNotifyError, err := getEnvBool("FAIL_ON_NOTIFY_ERROR")
 	if err != nil {
-		return fmt.Errorf("error getting current IP of the DNS: %w", err)
+		return PorkbunConfig{}, err
 	}
 
-	publicIP, err := getPublicIP()
+	desktopNotify, err := getEnvBool("DESKTOP_NOTIFY")
 	if err != nil {
-		return fmt.Errorf("error getting the public IP: %w", err)
+		return PorkbunConfig{}, err
 	}
 
-	if currentDNSIP == publicIP {
-		return nil
+	notifyOrder, err := parseNotifyOrder(os.Getenv("NOTIFY_ORDER"))
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	if err := updateDNSRecord(config, publicIP); err != nil {
-		return fmt.Errorf("error updating DNS register: %w", err)
+	notifyOrder, err = applyNotifyMethod(notifyOrder, os.Getenv("NOTIFY_METHOD"))
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	if err := SendSMS("Your IP has changed to " + publicIP); err != nil {
-		log.Printf("error sending the SMS: %v", err)
+	notifyOrder, err = checkNotificationChannels(notifyOrder, os.Getenv("NOTIFY_PARTIAL"))
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	return nil
-}
+	notifyCooldowns, err := loadNotifyCooldowns()
+	if err != nil {
+		return PorkbunConfig{}, err
+	}
 
-func validateConfig(config PorkbunConfig) error {
-	if config.APIKey == "" || config.SecretKey == "" || config.RecordID == "" {
-		return fmt.Errorf("required API keys missing")
+	metricsSummary, err := getEnvBool("METRICS_SUMMARY")
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
-	return nil
-}
 
-func getPublicIP() (string, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	currentIPSources, err := parseCurrentIPSources(os.Getenv("CURRENT_IP_SOURCE"))
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	resp, err := client.Get("https://api.ipify.org?format=text")
+	domain, err := normalizeDomain(os.Getenv("PORKBUN_DOMAIN"))
 	if err != nil {
-		return "", err
+		return PorkbunConfig{}, err
 	}
-	defer resp.Body.Close()
 
-	ip, err := io.ReadAll(resp.Body)
+	recordName, err := renderRecordName(os.Getenv("PORKBUN_SUBDOMAIN"))
 	if err != nil {
-		return "", err
+		return PorkbunConfig{}, err
 	}
 
-	return strings.TrimSpace(string(ip)), nil
-}
+	recordIDs, recordNames, err := loadRecordList()
+	if err != nil {
+		return PorkbunConfig{}, err
+	}
 
-func getCurrentDNSIP(config PorkbunConfig) (string, error) {
-	config.APIURL = "https://api.porkbun.com/api/json/v3/dns/retrieve/"
-	requestBody := map[string]string{
-		"secretapikey": config.SecretKey,
-		"apikey":       config.APIKey,
+	debug, err := getEnvBool("DEBUG")
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	jsonBody, err := json.Marshal(requestBody)
+	maxRecordAge, err := getEnvDuration("MAX_RECORD_AGE")
 	if err != nil {
-		return "", fmt.Errorf("error creating the JSON: %w", err)
+		return PorkbunConfig{}, err
 	}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	maxResponseBytes, err := getEnvInt("MAX_RESPONSE_BYTES")
+	if err != nil {
+		return PorkbunConfig{}, err
+	}
+	if maxResponseBytes == 0 {
+		maxResponseBytes = 1 << 20
 	}
 
-	var fullAPIURL string = config.APIURL + config.Domain + "/" + config.RecordID
-	req, err := http.NewRequest("POST", fullAPIURL, bytes.NewBuffer(jsonBody))
+	maxRetries, err := getEnvInt("MAX_RETRIES")
+	if err != nil {
+		return PorkbunConfig{}, err
+	}
+	if os.Getenv("MAX_RETRIES") == "" {
+		maxRetries = 3
+	}
 
+	ipProviders, err := parseIPProviders("IP_PROVIDERS")
 	if err != nil {
-		return "", fmt.Errorf("error creating the request: %w", err)
+		return PorkbunConfig{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	response, err := client.Do(req)
+	ipProvidersV6, err := parseIPProviders("IP_PROVIDERS_V6")
 	if err != nil {
-		return "", fmt.Errorf("error doing the request: %w", err)
+		return PorkbunConfig{}, err
 	}
-	defer response.Body.Close()
 
-	var porkbunResp PorkbunResponse
-	if err := json.NewDecoder(response.Body).Decode(&porkbunResp); err != nil {
-		return "", fmt.Errorf("error decoding the answer: %w", err)
+	ipMaxRedirects, err := getEnvInt("IP_MAX_REDIRECTS")
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	if len(porkbunResp.Records) == 0 {
-		return "", fmt.Errorf("DNS registers not found")
+	bootGrace, err := getEnvDuration("BOOT_GRACE")
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	currentIP := porkbunResp.Records[0].Content
-	return currentIP, nil
-}
+	dryRunEnv, err := getEnvBool("DRY_RUN")
+	if err != nil {
+		return PorkbunConfig{}, err
+	}
 
-func updateDNSRecord(config PorkbunConfig, newIP string) error {
-	requestBody := map[string]string{
-		"secretapikey": config.SecretKey,
-		"apikey":       config.APIKey,
-		"name":         config.RecordName,
-		"type":         config.RecordType,
-		"content":      newIP,
+	forceUpdate, err := getEnvBool("FORCE_UPDATE")
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	jsonBody, err := json.Marshal(requestBody)
+	trustCache, err := getEnvBool("TRUST_CACHE")
 	if err != nil {
-		return err
+		return PorkbunConfig{}, err
 	}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	updateInterval, err := getEnvDuration("UPDATE_INTERVAL")
+	if err != nil {
+		return PorkbunConfig{}, err
 	}
 
-	var fullAPIURL string = config.APIURL + config.Domain + "/" + config.RecordID
-	req, err := http.NewRequest("POST", fullAPIURL, bytes.NewBuffer(jsonBody))
+	cacheTTL, err := getEnvDuration("CACHE_TTL")
 	if err != nil {
-		return err
+		return PorkbunConfig{}, err
+	}
+	if cacheTTL == 0 {
+		cacheTTL = 24 * time.Hour
+	}
+
+	config := PorkbunConfig{
+		APIURL:     "https://api.porkbun.com/api/json/v3/",
+		APIKey:     getSecret("PORKBUN_API_KEY"),
+		SecretKey:  getSecret("PORKBUN_SECRET_KEY"),
+		RecordID:   os.Getenv("PORKBUN_RECORD_ID"),
+		Domain:     domain,
+		RecordName: recordName,
+		RecordType: strings.ToUpper(os.Getenv("PORKBUN_RECORD_TYPE")),
+
+		RecordIDAAAA: os.Getenv("PORKBUN_RECORD_ID_AAAA"),
+		RecordIDs:    recordIDs,
+		RecordNames:  recordNames,
+
+		ContentTemplate: os.Getenv("CONTENT_TEMPLATE"),
+		ContentRegex:    os.Getenv("CONTENT_REGEX"),
+
+		ExpectedCurrent:   os.Getenv("EXPECTED_CURRENT"),
+		FailOnNotifyError: failOnNotifyError,
+		DesktopNotify:     desktopNotify,
+		NotifyOrder:       notifyOrder,
+		NotifyCooldowns:   notifyCooldowns,
+		MetricsSummary:    metricsSummary,
+		MetricsFile:       os.Getenv("METRICS_FILE"),
+		Debug:             debug,
+		MaxResponseBytes:  int64(maxResponseBytes),
+		MaxRetries:        maxRetries,
+		IPProviders:       ipProviders,
+		IPProvidersV6:     ipProvidersV6,
+		IPMaxRedirects:    ipMaxRedirects,
+		BootGrace:         bootGrace,
+		CurrentIPSources:  currentIPSources,
+		DryRun:            dryRunEnv,
+		ForceUpdate:       forceUpdate,
+		TrustCache:        trustCache,
+		CacheTTL:          cacheTTL,
+		UpdateInterval:    updateInterval,
+		StateFile:         os.Getenv("STATE_FILE"),
+		MaxRecordAge:      maxRecordAge,
+	}
+
+	if config.RecordType == "" {
+		config.RecordType = "A"
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	return config, nil
+}
+
+func updateDNSIfNeeded(config PorkbunConfig) error {
+	metrics.resetCycle()
+
+	state, err := loadState(config.StateFile)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	var apiResponse APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
-		return fmt.Errorf("error decoding the answer: %w", err)
+	// The public IP of each family is only looked up once, even when it
+	// fails
+	type lookup struct {
+		ip  string
+		err error
+	}
+	lookups := map[int]lookup{}
+	publicIP := func(family int) (string, error) {
+		if result, ok := lookups[family]; ok {
+			return result.ip, result.err
+		}
+		ip, err := getPublicIP(config, family)
+		lookups[family] = lookup{ip, err}
+		return ip, err
+	}
+
+	records := recordConfigs(config)
+
+	// A client per cycle, so the records of a domain are retrieved once
+	// per cycle
+	client := newPorkbunClient(config)
+
+	var changedIPs, updated, current, failed []string
+	var errs []error
+	for _, record := range records {
+		label := recordFQDN(record) + " " + record.RecordType
+
+		ip, changed, err := updateRecordIfNeeded(client.forRecord(record), state, publicIP)
+		switch {
+		case err != nil:
+			if record.RecordLabel != "" {
+				err = fmt.Errorf("%s record: %w", label, err)
+			}
+			errs = append(errs, err)
+			failed = append(failed, label)
+		case changed:
+			if !slices.Contains(changedIPs, ip) {
+				changedIPs = append(changedIPs, ip)
+			}
+			updated = append(updated, label)
+		default:
+			current = append(current, label)
+		}
+
+		// Checked after the update attempt, so only a record this run
+		// couldn't bring up to date is alerted about, and a failing
+		// alert never keeps the record from being updated
+		if err := checkRecordAge(record, state); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(records) > 1 {
+		log.Printf("records updated: %s; already current: %s; failed: %s",
+			orDash(strings.Join(updated, ", ")), orDash(strings.Join(current, ", ")), orDash(strings.Join(failed, ", ")))
+	}
+
+	// A single notification covers every record that changed
+	if len(updated) > 0 {
+		message := "Your IP has changed to " + strings.Join(changedIPs, " and ")
+		if len(records) > 1 {
+			message += ", updated " + strings.Join(updated, ", ")
+		}
+		if err := notify(config, state, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// recordConfigs returns the configuration of every record to update:
+// each of PORKBUN_RECORD_IDS with the matching name of
+// PORKBUN_SUBDOMAINS, or with PORKBUN_RECORD_TYPE=both the A record
+// PORKBUN_RECORD_ID and the AAAA record PORKBUN_RECORD_ID_AAAA, or else
+// the single record PORKBUN_RECORD_ID.
+func recordConfigs(config PorkbunConfig) []PorkbunConfig {
+	if len(config.RecordIDs) > 0 {
+		records := make([]PorkbunConfig, len(config.RecordIDs))
+		for i, id := range config.RecordIDs {
+			record := config
+			record.RecordID = id
+			record.RecordName = config.RecordNames[i]
+			record.RecordLabel = recordFQDN(record)
+			records[i] = record
+		}
+		return records
+	}
+
+	if config.RecordType != "BOTH" {
+		return []PorkbunConfig{config}
+	}
+
+	ipv4, ipv6 := config, config
+	ipv4.RecordType = "A"
+	ipv6.RecordType = "AAAA"
+	ipv6.RecordID = config.RecordIDAAAA
+	ipv4.RecordLabel = "a"
+	ipv6.RecordLabel = "aaaa"
+	return []PorkbunConfig{ipv4, ipv6}
+}
+
+// loadRecordList reads PORKBUN_RECORD_IDS and the names of the records
+// from the matching entries of PORKBUN_SUBDOMAINS, where an empty entry
+// or "@" is the apex
+func loadRecordList() ([]string, []string, error) {
+	value := os.Getenv("PORKBUN_RECORD_IDS")
+	if value == "" {
+		return nil, nil, nil
 	}
 
-	if apiResponse.Status != "SUCCESS" {
-		return fmt.Errorf("API error: %s", apiResponse.Message)
+	ids := strings.Split(value, ",")
+	names := strings.Split(os.Getenv("PORKBUN_SUBDOMAINS"), ",")
+	if len(names) != len(ids) {
+		return nil, nil, fmt.Errorf("PORKBUN_RECORD_IDS has %d records but PORKBUN_SUBDOMAINS has %d names", len(ids), len(names))
+	}
+
+	for i := range ids {
+		ids[i] = strings.TrimSpace(ids[i])
+		if ids[i] == "" {
+			return nil, nil, fmt.Errorf("empty record ID in PORKBUN_RECORD_IDS")
+		}
+
+		name, err := renderRecordName(strings.TrimSpace(names[i]))
+		if err != nil {
+			return nil, nil, err
+		}
+		names[i] = name
+	}
+
+	return ids, names, nil
+}
+
+// updateRecordIfNeeded brings a single record up to date with the public
+// IP of its family, returning the IP and whether the record changed.
+// The caller notifies about the change.
+func updateRecordIfNeeded(client *PorkbunClient, state *State, publicIP func(family int) (string, error)) (string, bool, error) {
+	config := client.Config
+
+	ip, err := publicIP(ipFamily(config.RecordType))
+	if err != nil {
+		return "", false, fmt.Errorf("error getting the public IP: %w", err)
+	}
+
+	if err := checkIPFamily(config.RecordType, ip); err != nil {
+		return "", false, err
+	}
+
+	content, err := renderContent(config, ip)
+	if err != nil {
+		return "", false, err
+	}
+
+	recordState := state.record(config.RecordID)
+
+	// Trusting the cache skips retrieving the record while the public
+	// IP matches what the previous runs set
+	if config.TrustCache && !config.ForceUpdate && !config.DryRun {
+		if cached, err := getCachedContent(config, state); err == nil && recordContentEqual(config.RecordType, cached, content) {
+			metrics.setContent(cached, cached, false)
+			publishMQTT(config, cached, cached, false)
+			recordState.LastSuccess = time.Now()
+			return ip, false, state.save(config.StateFile)
+		}
+	}
+
+	currentDNSIP, source, err := getCurrentContent(client, state)
+	if err != nil {
+		return "", false, fmt.Errorf("error getting current IP of the DNS: %w", err)
+	}
+
+	if config.DryRun {
+		return ip, false, dryRunRecord(config, currentDNSIP, content)
+	}
+
+	if recordContentEqual(config.RecordType, currentDNSIP, content) {
+		// Porkbun answers SUCCESS to an edit that doesn't change
+		// anything, so a forced edit of the same content is counted as
+		// a reaffirmation, never as a change
+		if config.ForceUpdate {
+			if err := client.EditRecord(content); err != nil {
+				return "", false, fmt.Errorf("error updating DNS register: %w", err)
+			}
+			metrics.setReaffirmed()
+		}
+
+		metrics.setContent(currentDNSIP, currentDNSIP, false)
+		publishMQTT(config, currentDNSIP, currentDNSIP, false)
+		recordState.Content = currentDNSIP
+		recordState.LastSuccess = time.Now()
+		if source != "cache" || config.ForceUpdate {
+			recordState.LastSync = recordState.LastSuccess
+		}
+		return ip, false, state.save(config.StateFile)
+	}
+
+	if err := verifyRecordOwnership(config, currentDNSIP); err != nil {
+		if notifyErr := notify(config, state, "Refusing to update the DNS record: "+err.Error()); notifyErr != nil {
+			return "", false, fmt.Errorf("%w (and the alert failed: %v)", err, notifyErr)
+		}
+		return "", false, err
+	}
+
+	if err := client.EditRecord(content); err != nil {
+		return "", false, fmt.Errorf("error updating DNS register: %w", err)
+	}
+
+	metrics.setContent(currentDNSIP, content, true)
+	publishMQTT(config, currentDNSIP, content, true)
+
+	recordState.Content = content
+	recordState.LastChange = time.Now()
+	recordState.LastSuccess = recordState.LastChange
+	recordState.LastSync = recordState.LastChange
+	if err := state.save(config.StateFile); err != nil {
+		return "", false, err
+	}
+
+	return ip, true, nil
+}
+
+// dryRunRecord logs what updating the record would do, without writing
+// anything
+func dryRunRecord(config PorkbunConfig, currentContent, content string) error {
+	metrics.setContent(currentContent, currentContent, false)
+
+	name := config.RecordName
+	if name == "" {
+		name = "@"
+	}
+
+	switch {
+	case recordContentEqual(config.RecordType, currentContent, content) && config.ForceUpdate:
+		log.Printf("dry run: would reaffirm %s/%s with %s", config.Domain, name, content)
+	case recordContentEqual(config.RecordType, currentContent, content):
+		log.Printf("dry run: no change, current IP matches, %s/%s is %s", config.Domain, name, currentContent)
+	default:
+		if err := verifyRecordOwnership(config, currentContent); err != nil {
+			return err
+		}
+		log.Printf("dry run: would update %s/%s from %s to %s", config.Domain, name, currentContent, content)
 	}
 
 	return nil
 }
 
-func SendSMS(message string) error {
+func getEnvBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q: %w", name, value, err)
+	}
+	return parsed, nil
+}
+
+func getEnvInt(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s value %q, expected a non negative integer", name, value)
+	}
+	return parsed, nil
+}
 
-	config := TwilioConfig{
-		AccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
-		AuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+func getEnvDuration(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %w", name, value, err)
+	}
+	return parsed, nil
+}
+
+// recordContentEqual compares two record contents with the semantics of
+// the record type: addresses are compared as IPs, hostnames (including
+// ALIAS targets) ignore case and the trailing dot, anything else (like
+// TXT) must match exactly.
+func recordContentEqual(recordType, current, desired string) bool {
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA":
+		currentIP, desiredIP := net.ParseIP(current), net.ParseIP(desired)
+		if currentIP != nil && desiredIP != nil {
+			return currentIP.Equal(desiredIP)
+		}
+	case "CNAME", "ALIAS", "MX", "NS":
+		return strings.EqualFold(strings.TrimSuffix(current, "."), strings.TrimSuffix(desired, "."))
+	}
+
+	return current == desired
+}
+
+func validateConfig(config PorkbunConfig) error {
+	if config.APIKey == "" || config.SecretKey == "" || (config.RecordID == "" && len(config.RecordIDs) == 0) {
+		return fmt.Errorf("required API keys missing")
+	}
+	if config.RecordType == "BOTH" && len(config.RecordIDs) > 0 {
+		return fmt.Errorf("PORKBUN_RECORD_TYPE=both can't be used with PORKBUN_RECORD_IDS")
+	}
+	if config.RecordType == "BOTH" && config.RecordIDAAAA == "" {
+		return fmt.Errorf("PORKBUN_RECORD_TYPE=both requires PORKBUN_RECORD_ID_AAAA")
+	}
+	for _, record := range recordConfigs(config) {
+		if record.RecordType == "CNAME" && (record.RecordName == "" || record.RecordName == "@") {
+			return fmt.Errorf("a CNAME record isn't allowed at the apex of %s, use an ALIAS or A record instead, or set PORKBUN_SUBDOMAIN", config.Domain)
+		}
+	}
+	if config.ExpectedCurrent != "" {
+		if _, err := regexp.Compile(config.ExpectedCurrent); err != nil {
+			return fmt.Errorf("invalid EXPECTED_CURRENT pattern: %w", err)
+		}
+	}
+	if config.ContentTemplate != "" {
+		if _, err := parseContentTemplate(config.ContentTemplate); err != nil {
+			return fmt.Errorf("invalid CONTENT_TEMPLATE: %w", err)
+		}
+	}
+	if config.ContentRegex != "" {
+		if _, err := regexp.Compile(config.ContentRegex); err != nil {
+			return fmt.Errorf("invalid CONTENT_REGEX pattern: %w", err)
+		}
+	}
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("invalid MAX_RETRIES %d, expected a non negative integer", config.MaxRetries)
+	}
+	if config.UpdateInterval < 0 {
+		return fmt.Errorf("invalid interval %s, expected a positive duration", config.UpdateInterval)
+	}
+	if config.MaxRecordAge != 0 && config.StateFile == "" {
+		return fmt.Errorf("MAX_RECORD_AGE requires STATE_FILE")
+	}
+	if len(config.NotifyCooldowns) > 0 && config.StateFile == "" {
+		return fmt.Errorf("notification cooldowns require STATE_FILE")
+	}
+	if config.TrustCache && config.StateFile == "" {
+		return fmt.Errorf("TRUST_CACHE requires STATE_FILE")
+	}
+	if slices.Contains(config.CurrentIPSources, "cache") && config.StateFile == "" {
+		return fmt.Errorf("the cache source of CURRENT_IP_SOURCE requires STATE_FILE")
+	}
+	return nil
+}
+
+// verifyRecordOwnership checks that the current content of the record
+// matches EXPECTED_CURRENT, so a record that unexpectedly points
+// somewhere else is never overwritten. The pattern is a regular
+// expression that has to match the whole content.
+func verifyRecordOwnership(config PorkbunConfig, currentContent string) error {
+	if config.ExpectedCurrent == "" {
+		return nil
+	}
+
+	pattern, err := regexp.Compile("^(?:" + config.ExpectedCurrent + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid EXPECTED_CURRENT pattern: %w", err)
+	}
+
+	if !pattern.MatchString(currentContent) {
+		return fmt.Errorf("current content %q of %s does not match the expected %q", currentContent, config.Domain, config.ExpectedCurrent)
+	}
+
+	return nil
+}
+
+func loadTwilioConfig() TwilioConfig {
+	return TwilioConfig{
+		AccountSID: getSecret("TWILIO_ACCOUNT_SID"),
+		AuthToken:  getSecret("TWILIO_AUTH_TOKEN"),
 		FromPhone:  os.Getenv("TWILIO_FROM_PHONE"),
 		ToPhone:    os.Getenv("TWILIO_TO_PHONE"),
 	}
+}
+
+// missingFields returns the names of the fields that aren't set
+func (c TwilioConfig) missingFields() []string {
+	var missing []string
+	for name, value := range map[string]string{
+		"TWILIO_ACCOUNT_SID": c.AccountSID,
+		"TWILIO_AUTH_TOKEN":  c.AuthToken,
+		"TWILIO_FROM_PHONE":  c.FromPhone,
+		"TWILIO_TO_PHONE":    c.ToPhone,
+	} {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+func SendSMS(message string) error {
+
+	config := loadTwilioConfig()
 
 	apiURL := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", url.PathEscape(config.AccountSID))
 
@@ -230,8 +868,8 @@ func SendSMS(message string) error {
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.SetBasicAuth(config.AccountSID, config.AuthToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	client := &http.Client{Timeout: 30 * time.Second, Transport: httpTransport}
+	resp, err := doRequest(client, req, "twilio")
 	if err != nil {
 		return fmt.Errorf("error sending the SMS: %w", err)
 	}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRecordContentEqual(t *testing.T) {
+	tests := []struct {
+		recordType string
+		current    string
+		desired    string
+		want       bool
+	}{
+		{"CNAME", "Example.com", "example.com.", true},
+		{"ALIAS", "Example.com", "example.com.", true},
+		{"CNAME", "example.com", "example.net", false},
+		{"TXT", "Hello", "hello", false},
+		{"TXT", "hello", "hello", true},
+		{"AAAA", "::1", "0:0::1", true},
+		{"AAAA", "2001:db8::1", "2001:db8::2", false},
+		{"A", "203.0.113.10", "203.0.113.10", true},
+		{"A", "203.0.113.10", "203.0.113.20", false},
+	}
+
+	for _, test := range tests {
+		if got := recordContentEqual(test.recordType, test.current, test.desired); got != test.want {
+			t.Errorf("recordContentEqual(%q, %q, %q) = %v, want %v", test.recordType, test.current, test.desired, got, test.want)
+		}
+	}
+}
+
+func TestFlexStringUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    flexString
+		wantErr bool
+	}{
+		{json: `"203.0.113.10"`, want: "203.0.113.10"},
+		{json: `600`, want: "600"},
+		{json: `1.5`, want: "1.5"},
+		{json: `null`, want: ""},
+		{json: ` "padded" `, want: "padded"},
+		{json: `{"value":"600"}`, wantErr: true},
+		{json: `true`, wantErr: true},
+		{json: `["600"]`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		var got flexString
+		err := got.UnmarshalJSON([]byte(test.json))
+		if (err != nil) != test.wantErr {
+			t.Errorf("UnmarshalJSON(%s) error = %v, want error %v", test.json, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("UnmarshalJSON(%s) = %q, want %q", test.json, got, test.want)
+		}
+	}
+}
+
+func TestRecordUnmarshalJSON(t *testing.T) {
+	var record Record
+	if err := json.Unmarshal([]byte(`{"id":123,"name":"home.example.com","type":"A","content":null,"ttl":600,"prio":null}`), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.ID != "123" || record.Content != "" || record.TTL != "600" || record.Prio != "" {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestValidateConfigApexRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		recordName string
+		wantErr    string
+	}{
+		{name: "CNAME without name", recordType: "CNAME", recordName: "", wantErr: "a CNAME record isn't allowed at the apex of example.com"},
+		{name: "CNAME at @", recordType: "CNAME", recordName: "@", wantErr: "a CNAME record isn't allowed at the apex of example.com"},
+		{name: "CNAME on a subdomain", recordType: "CNAME", recordName: "www"},
+		{name: "ALIAS at the apex", recordType: "ALIAS", recordName: ""},
+		{name: "ALIAS at @", recordType: "ALIAS", recordName: "@"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := PorkbunConfig{
+				APIKey:     "pk1_test",
+				SecretKey:  "sk1_test",
+				RecordID:   "1",
+				Domain:     "example.com",
+				RecordName: test.recordName,
+				RecordType: test.recordType,
+			}
+			checkError(t, validateConfig(config), test.wantErr)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+var hostnamePattern = regexp.MustCompile(`^(?i)([a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.?$`)
+
+// Functions available in CONTENT_TEMPLATE
+var contentTemplateFuncs = template.FuncMap{
+	// reverse reverses the labels of an IPv4 address, 1.2.3.4 -> 4.3.2.1
+	"reverse": func(ip string) string {
+		labels := strings.Split(ip, ".")
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return strings.Join(labels, ".")
+	},
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+}
+
+func parseContentTemplate(text string) (*template.Template, error) {
+	return template.New("content").Funcs(contentTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderContent returns the content the record should have for the
+// given IP. Without CONTENT_TEMPLATE it's the IP itself, otherwise the
+// template is executed with the IP as {{.IP}}. The result is validated
+// against the record type and has to match the whole CONTENT_REGEX.
+func renderContent(config PorkbunConfig, ip string) (string, error) {
+	content := ip
+	if config.ContentTemplate != "" {
+		tmpl, err := parseContentTemplate(config.ContentTemplate)
+		if err != nil {
+			return "", fmt.Errorf("invalid CONTENT_TEMPLATE: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, struct{ IP string }{IP: ip}); err != nil {
+			return "", fmt.Errorf("error rendering CONTENT_TEMPLATE: %w", err)
+		}
+		content = strings.TrimSpace(buf.String())
+	}
+
+	if err := validateContent(config.RecordType, content); err != nil {
+		return "", err
+	}
+
+	if config.ContentRegex != "" {
+		pattern, err := regexp.Compile("^(?:" + config.ContentRegex + ")$")
+		if err != nil {
+			return "", fmt.Errorf("invalid CONTENT_REGEX pattern: %w", err)
+		}
+		if !pattern.MatchString(content) {
+			return "", fmt.Errorf("content %q doesn't match CONTENT_REGEX %q, refusing to write it", content, config.ContentRegex)
+		}
+	}
+
+	return content, nil
+}
+
+// checkIPFamily checks that the detected IP can go in the record, so an
+// IPv6 address detected on an IPv6-only network is never written to an
+// A record (or the other way around). Other record types take any IP.
+func checkIPFamily(recordType, ip string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return fmt.Errorf("%q is not a valid IP", ip)
+	}
+
+	isIPv4 := parsed.To4() != nil
+	switch {
+	case recordType == "A" && !isIPv4:
+		return fmt.Errorf("the public IP %s is IPv6 but the record is A, this network may be IPv6-only; use PORKBUN_RECORD_TYPE=AAAA", ip)
+	case recordType == "AAAA" && isIPv4:
+		return fmt.Errorf("the public IP %s is IPv4 but the record is AAAA, this network may not have IPv6; use PORKBUN_RECORD_TYPE=A", ip)
+	}
+
+	return nil
+}
+
+// validateContent checks that the content is valid for the record type
+func validateContent(recordType, content string) error {
+	if content == "" {
+		return fmt.Errorf("empty content for the %s record", recordType)
+	}
+
+	switch strings.ToUpper(recordType) {
+	case "A":
+		if ip := net.ParseIP(content); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("content %q is not a valid IPv4 address for an A record", content)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(content); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("content %q is not a valid IPv6 address for an AAAA record", content)
+		}
+	case "CNAME", "ALIAS", "MX", "NS":
+		if len(content) > 253 || !hostnamePattern.MatchString(content) {
+			return fmt.Errorf("content %q is not a valid hostname for a %s record", content, recordType)
+		}
+	}
+
+	return nil
+}
+
+// normalizeDomain cleans up PORKBUN_DOMAIN, accepting a trailing dot or
+// a pasted URL, and checks it's a registrable domain. A domain with a
+// subdomain is rejected suggesting to move it to PORKBUN_SUBDOMAIN.
+func normalizeDomain(value string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(value))
+	domain = strings.TrimPrefix(domain, "https://")
+	domain = strings.TrimPrefix(domain, "http://")
+	domain = strings.TrimSuffix(domain, "/")
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" {
+		return "", nil
+	}
+
+	if strings.ContainsAny(domain, "/:@ ") || !hostnamePattern.MatchString(domain) {
+		return "", fmt.Errorf("PORKBUN_DOMAIN %q is not a valid domain", value)
+	}
+
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return "", fmt.Errorf("PORKBUN_DOMAIN %q is not a registrable domain: %w", value, err)
+	}
+
+	if registrable != domain {
+		subdomain := strings.TrimSuffix(domain, "."+registrable)
+		return "", fmt.Errorf("PORKBUN_DOMAIN %q includes the subdomain %q, set PORKBUN_DOMAIN=%s and PORKBUN_SUBDOMAIN=%s", value, subdomain, registrable, subdomain)
+	}
+
+	return domain, nil
+}
+
+// renderRecordName expands PORKBUN_SUBDOMAIN as a template, so every
+// host of a fleet can register under its own name with the same config,
+// e.g. "{{.Hostname}}.dyn". {{.Hostname}} is the first label of the OS
+// hostname, in lower case, and {{env "NAME"}} the value of an
+// environment variable. The result must be a valid sequence of labels.
+func renderRecordName(text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("error getting the hostname: %w", err)
+	}
+	hostname, _, _ = strings.Cut(strings.ToLower(hostname), ".")
+
+	tmpl, err := template.New("name").Funcs(template.FuncMap{"env": os.Getenv}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid PORKBUN_SUBDOMAIN template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ Hostname string }{Hostname: hostname}); err != nil {
+		return "", fmt.Errorf("error rendering PORKBUN_SUBDOMAIN: %w", err)
+	}
+
+	name := strings.ToLower(strings.TrimSpace(buf.String()))
+	if name != "" && (len(name) > 253 || strings.HasSuffix(name, ".") || !hostnamePattern.MatchString(name)) {
+		return "", fmt.Errorf("PORKBUN_SUBDOMAIN rendered to %q, which is not a valid record name", name)
+	}
+
+	return name, nil
+}
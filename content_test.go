@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "example.com.", want: "example.com"},
+		{value: "HTTPS://Example.com/", want: "example.com"},
+		{value: "www.example.com", wantErr: `includes the subdomain "www", set PORKBUN_DOMAIN=example.com and PORKBUN_SUBDOMAIN=www`},
+		{value: "example.co.uk", want: "example.co.uk"},
+		{value: "co.uk", wantErr: "is not a registrable domain"},
+		{value: "", want: ""},
+		{value: "example.com/path", wantErr: "is not a valid domain"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := normalizeDomain(test.value)
+			checkError(t, err, test.wantErr)
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
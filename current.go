@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+var currentIPSources = []string{"cache", "api", "resolve"}
+
+func parseCurrentIPSources(value string) ([]string, error) {
+	if value == "" {
+		return []string{"api"}, nil
+	}
+
+	var sources []string
+	for _, source := range strings.Split(value, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source == "" {
+			continue
+		}
+		if !slices.Contains(currentIPSources, source) {
+			return nil, fmt.Errorf("unknown source %q in CURRENT_IP_SOURCE, expected cache, api or resolve", source)
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("CURRENT_IP_SOURCE %q has no source, expected cache, api or resolve", value)
+	}
+
+	return sources, nil
+}
+
+// getCurrentContent returns the current content of the record from the
+// first source of CURRENT_IP_SOURCE that has it, falling back to the
+// next one when a source fails:
+//   - cache: the content set or confirmed by the previous runs, from
+//     STATE_FILE, while it was checked against Porkbun within
+//     CACHE_TTL. Costs nothing but won't notice changes done outside
+//     the updater.
+//   - api: the record retrieved from Porkbun. Always accurate but costs
+//     an API call.
+//   - resolve: a DNS lookup of the record. Doesn't use the API but may
+//     return a value cached by resolvers until the TTL expires.
+//
+// The source the content was taken from is returned with it.
+func getCurrentContent(client *PorkbunClient, state *State) (string, string, error) {
+	config := client.Config
+	if len(config.CurrentIPSources) == 0 {
+		return "", "", errors.New("no source to get the current content from, check CURRENT_IP_SOURCE")
+	}
+
+	var errs []error
+
+	for _, source := range config.CurrentIPSources {
+		var content string
+		var err error
+
+		switch source {
+		case "cache":
+			content, err = getCachedContent(config, state)
+		case "api":
+			content, err = client.RetrieveRecord()
+		case "resolve":
+			content, err = resolveCurrentContent(config)
+		}
+
+		if err == nil {
+			if config.Debug {
+				log.Printf("current content %q taken from the %s source", content, source)
+			}
+			return content, source, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", source, err))
+	}
+
+	return "", "", errors.Join(errs...)
+}
+
+func getCachedContent(config PorkbunConfig, state *State) (string, error) {
+	recordState, ok := state.Records[config.RecordID]
+	if !ok || recordState.Content == "" {
+		return "", fmt.Errorf("no cached content for the record")
+	}
+	if time.Since(recordState.LastSync) > config.CacheTTL {
+		return "", fmt.Errorf("the cached content wasn't checked against Porkbun within CACHE_TTL")
+	}
+	return recordState.Content, nil
+}
+
+func resolveCurrentContent(config PorkbunConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name := recordFQDN(config)
+
+	switch config.RecordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if config.RecordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := net.DefaultResolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return "", err
+		}
+		return ips[0].String(), nil
+	case "CNAME":
+		cname, err := net.DefaultResolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(cname, "."), nil
+	case "TXT":
+		txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if len(txts) == 0 {
+			return "", fmt.Errorf("no TXT records for %s", name)
+		}
+		return txts[0], nil
+	}
+
+	return "", fmt.Errorf("%s records can't be resolved", config.RecordType)
+}
+
+// recordFQDN returns the full name of the record
+func recordFQDN(config PorkbunConfig) string {
+	if config.RecordName == "" || config.RecordName == "@" {
+		return config.Domain
+	}
+	return config.RecordName + "." + config.Domain
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestParseCurrentIPSources(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr string
+	}{
+		{value: "", want: []string{"api"}},
+		{value: "cache,api", want: []string{"cache", "api"}},
+		{value: " Resolve , API ", want: []string{"resolve", "api"}},
+		{value: "cache,,api", want: []string{"cache", "api"}},
+		{value: ",", wantErr: "CURRENT_IP_SOURCE \",\" has no source"},
+		{value: " , ", wantErr: "CURRENT_IP_SOURCE \" , \" has no source"},
+		{value: "cache,dns", wantErr: `unknown source "dns" in CURRENT_IP_SOURCE`},
+	}
+
+	for _, test := range tests {
+		got, err := parseCurrentIPSources(test.value)
+		checkError(t, err, test.wantErr)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("parseCurrentIPSources(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestGetCurrentContentWithoutSources(t *testing.T) {
+	client := newTestPorkbunClient(t, http.StatusOK, `{"status":"SUCCESS","records":[]}`, nil)
+	client.Config.CurrentIPSources = nil
+
+	_, _, err := getCurrentContent(client, &State{})
+	checkError(t, err, "no source to get the current content from")
+}
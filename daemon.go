@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runDaemon updates the DNS every UPDATE_INTERVAL until it receives
+// SIGINT or SIGTERM. A failed cycle is only logged, the next one is
+// tried on schedule. A signal received during a cycle stops the daemon
+// once the cycle ends.
+func runDaemon(config PorkbunConfig) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(config.UpdateInterval)
+	defer ticker.Stop()
+
+	log.Printf("checking the DNS every %s", config.UpdateInterval)
+	for {
+		if err := runCycle(config); err != nil {
+			log.Printf("error updating the DNS: %v", err)
+		}
+
+		select {
+		case sig := <-signals:
+			log.Printf("received %s, stopping", sig)
+			return
+		case <-ticker.C:
+		}
+	}
+}
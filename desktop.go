@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/gen2brain/beeep"
+)
+
+// SendDesktop pops a desktop notification. It's a no-op when there is
+// no graphical session, so DESKTOP_NOTIFY can stay enabled on servers.
+func SendDesktop(message string) error {
+	if !hasDesktopSession() {
+		return nil
+	}
+
+	if err := beeep.Notify("Porkbun IP updater", message, ""); err != nil {
+		return fmt.Errorf("error sending the desktop notification: %w", err)
+	}
+
+	return nil
+}
+
+func hasDesktopSession() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	default:
+		return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	}
+}
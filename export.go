@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type configEnvVar struct {
+	Name   string
+	Secret bool
+	// Flag that sets the same option, if any
+	Flag string
+	// Value returns the effective value of the variable in the loaded
+	// configuration; nil for the variables that aren't part of it, which
+	// are exported as read from the environment
+	Value func(config PorkbunConfig) string
+}
+
+// Every environment variable read by the updater, in the order they
+// are exported
+var configEnvVars = []configEnvVar{
+	{Name: "PORKBUN_API_KEY", Secret: true, Value: func(c PorkbunConfig) string { return c.APIKey }},
+	{Name: "PORKBUN_SECRET_KEY", Secret: true, Value: func(c PorkbunConfig) string { return c.SecretKey }},
+	{Name: "PORKBUN_DOMAIN", Value: func(c PorkbunConfig) string { return c.Domain }},
+	{Name: "PORKBUN_SUBDOMAIN", Value: func(c PorkbunConfig) string { return c.RecordName }},
+	{Name: "PORKBUN_RECORD_ID", Value: func(c PorkbunConfig) string { return c.RecordID }},
+	{Name: "PORKBUN_RECORD_TYPE", Value: func(c PorkbunConfig) string { return c.RecordType }},
+	{Name: "PORKBUN_RECORD_ID_AAAA", Value: func(c PorkbunConfig) string { return c.RecordIDAAAA }},
+	{Name: "PORKBUN_RECORD_IDS", Value: func(c PorkbunConfig) string { return strings.Join(c.RecordIDs, ",") }},
+	{Name: "PORKBUN_SUBDOMAINS", Value: func(c PorkbunConfig) string { return strings.Join(c.RecordNames, ",") }},
+	{Name: "CONTENT_TEMPLATE", Value: func(c PorkbunConfig) string { return c.ContentTemplate }},
+	{Name: "CONTENT_REGEX", Value: func(c PorkbunConfig) string { return c.ContentRegex }},
+	{Name: "EXPECTED_CURRENT", Value: func(c PorkbunConfig) string { return c.ExpectedCurrent }},
+	{Name: "FAIL_ON_NOTIFY_ERROR", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.FailOnNotifyError) }},
+	{Name: "DESKTOP_NOTIFY", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.DesktopNotify) }},
+	{Name: "NOTIFY_METHOD"},
+	{Name: "NOTIFY_ORDER", Value: func(c PorkbunConfig) string { return strings.Join(c.NotifyOrder, ",") }},
+	{Name: "NOTIFY_PARTIAL"},
+	{Name: "METRICS_SUMMARY", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.MetricsSummary) }},
+	{Name: "METRICS_FILE", Value: func(c PorkbunConfig) string { return c.MetricsFile }},
+	{Name: "DEBUG", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.Debug) }},
+	{Name: "MAX_RESPONSE_BYTES", Value: func(c PorkbunConfig) string { return strconv.FormatInt(c.MaxResponseBytes, 10) }},
+	{Name: "MAX_RETRIES", Value: func(c PorkbunConfig) string { return strconv.Itoa(c.MaxRetries) }},
+	{Name: "IP_PROVIDERS", Value: func(c PorkbunConfig) string { return strings.Join(c.IPProviders, ",") }},
+	{Name: "IP_PROVIDERS_V6", Value: func(c PorkbunConfig) string { return strings.Join(c.IPProvidersV6, ",") }},
+	{Name: "IP_MAX_REDIRECTS", Value: func(c PorkbunConfig) string { return strconv.Itoa(c.IPMaxRedirects) }},
+	{Name: "BOOT_GRACE", Value: func(c PorkbunConfig) string { return c.BootGrace.String() }},
+	{Name: "CURRENT_IP_SOURCE", Value: func(c PorkbunConfig) string { return strings.Join(c.CurrentIPSources, ",") }},
+	{Name: "DRY_RUN", Flag: "dry-run", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.DryRun) }},
+	{Name: "FORCE_UPDATE", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.ForceUpdate) }},
+	{Name: "TRUST_CACHE", Value: func(c PorkbunConfig) string { return strconv.FormatBool(c.TrustCache) }},
+	{Name: "CACHE_TTL", Value: func(c PorkbunConfig) string { return c.CacheTTL.String() }},
+	{Name: "UPDATE_INTERVAL", Flag: "interval", Value: func(c PorkbunConfig) string { return c.UpdateInterval.String() }},
+	{Name: "STATE_FILE", Value: func(c PorkbunConfig) string { return c.StateFile }},
+	{Name: "MAX_RECORD_AGE", Value: func(c PorkbunConfig) string { return c.MaxRecordAge.String() }},
+	{Name: "TWILIO_ACCOUNT_SID", Secret: true},
+	{Name: "TWILIO_AUTH_TOKEN", Secret: true},
+	{Name: "TWILIO_FROM_PHONE"},
+	{Name: "TWILIO_TO_PHONE"},
+	{Name: "NOTIFY_WEBHOOK_URL", Secret: true},
+	{Name: "TWILIO_COOLDOWN", Value: func(c PorkbunConfig) string { return c.NotifyCooldowns["sms"].String() }},
+	{Name: "WEBHOOK_COOLDOWN", Value: func(c PorkbunConfig) string { return c.NotifyCooldowns["webhook"].String() }},
+	{Name: "DESKTOP_COOLDOWN", Value: func(c PorkbunConfig) string { return c.NotifyCooldowns["desktop"].String() }},
+	{Name: "MQTT_BROKER"},
+	{Name: "MQTT_TOPIC"},
+	{Name: "MQTT_USERNAME"},
+	{Name: "MQTT_PASSWORD", Secret: true},
+	{Name: "KEYRING_SERVICE"},
+	{Name: "RECORD_FILE"},
+	{Name: "REPLAY_FILE"},
+}
+
+// exportConfig prints the effective configuration in the given format,
+// as "env" variables or as the "flags" of the options that have one.
+// Secrets are redacted unless showSecrets is set.
+func exportConfig(w io.Writer, format string, config PorkbunConfig, showSecrets bool) error {
+	switch format {
+	case "env":
+		for _, envVar := range configEnvVars {
+			fmt.Fprintf(w, "export %s=%s\n", envVar.Name, shellQuote(envVar.effectiveValue(config, showSecrets)))
+		}
+	case "flags":
+		// Options left at their default are omitted
+		var flags []string
+		for _, envVar := range configEnvVars {
+			if envVar.Flag == "" {
+				continue
+			}
+			switch value := envVar.effectiveValue(config, showSecrets); value {
+			case "", "false", "0s":
+			case "true":
+				flags = append(flags, "-"+envVar.Flag)
+			default:
+				flags = append(flags, "-"+envVar.Flag+"="+shellQuote(value))
+			}
+		}
+		fmt.Fprintln(w, strings.Join(flags, " "))
+	default:
+		return fmt.Errorf("unsupported export format %q, expected env or flags", format)
+	}
+
+	return nil
+}
+
+// effectiveValue returns the value of the variable in the configuration,
+// or in the environment when the configuration doesn't have it
+func (envVar configEnvVar) effectiveValue(config PorkbunConfig, showSecrets bool) string {
+	var value string
+	switch {
+	case envVar.Value != nil:
+		value = envVar.Value(config)
+	case envVar.Secret:
+		value = getSecret(envVar.Name)
+	default:
+		value = os.Getenv(envVar.Name)
+	}
+
+	if envVar.Secret && value != "" && !showSecrets {
+		value = "REDACTED"
+	}
+	return value
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportConfigEnv(t *testing.T) {
+	t.Setenv("PORKBUN_API_KEY", "pk1_test")
+	t.Setenv("PORKBUN_DOMAIN", "Example.COM.")
+	t.Setenv("PORKBUN_RECORD_TYPE", "")
+	t.Setenv("MAX_RETRIES", "")
+	t.Setenv("KEYRING_SERVICE", "")
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := exportConfig(&out, "env", config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"export PORKBUN_API_KEY='REDACTED'\n",
+		"export PORKBUN_DOMAIN='example.com'\n",
+		"export PORKBUN_RECORD_TYPE='A'\n",
+		"export MAX_RETRIES='3'\n",
+		"export CACHE_TTL='24h0m0s'\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("the export doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestExportConfigFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PorkbunConfig
+		want   string
+	}{
+		{name: "defaults", want: "\n"},
+		{name: "interval", config: PorkbunConfig{UpdateInterval: 5 * time.Minute}, want: "-interval='5m0s'\n"},
+		{name: "interval and dry run", config: PorkbunConfig{UpdateInterval: time.Hour, DryRun: true}, want: "-dry-run -interval='1h0m0s'\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := exportConfig(&out, "flags", test.config, false); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("got %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestExportConfigUnknownFormat(t *testing.T) {
+	checkError(t, exportConfig(&strings.Builder{}, "yaml", PorkbunConfig{}, false), `unsupported export format "yaml"`)
+}
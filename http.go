@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Largest response body read from any endpoint, set from
+// MAX_RESPONSE_BYTES
+var maxResponseBytes int64 = 1 << 20
+
+// limitedBody fails the read once more than limit bytes were read, so a
+// broken or malicious endpoint can't stream an endless body
+type limitedBody struct {
+	body  io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64) io.ReadCloser {
+	return &limitedBody{body: body, limit: limit}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, fmt.Errorf("response body exceeds MAX_RESPONSE_BYTES (%d bytes)", b.limit)
+	}
+
+	// Read at most one byte past the limit to tell whether it was exceeded
+	if remaining := b.limit + 1 - b.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return 0, fmt.Errorf("response body exceeds MAX_RESPONSE_BYTES (%d bytes)", b.limit)
+	}
+
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// Delay before the first retry, doubled on every following one up to
+// maxRetryDelay
+var retryBaseDelay = time.Second
+
+// Longest wait between two attempts, before the jitter
+const maxRetryDelay = 30 * time.Second
+
+// doRequestWithRetry does the request built by newRequest with
+// doRequest, retrying network errors and 5xx answers up to retries
+// times with exponential backoff, capped at maxRetryDelay, and jitter.
+// Any other answer, 4xx included, is returned as it is, retrying
+// wouldn't change it.
+func doRequestWithRetry(client *http.Client, newRequest func() (*http.Request, error), endpoint string, retries int) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("error creating the request: %w", err)
+		}
+
+		resp, err := doRequest(client, req, endpoint)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, req.URL.Host)
+		}
+
+		if attempt > retries {
+			if retries > 0 {
+				return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return nil, err
+		}
+
+		wait := retryDelay(attempt)
+		log.Printf("%s attempt %d failed, retrying in %s: %v", endpoint, attempt, wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+	}
+}
+
+// retryDelay returns the wait after the failed attempt, retryBaseDelay
+// doubled on every attempt up to maxRetryDelay, plus up to half of it
+// of jitter
+func retryDelay(attempt int) time.Duration {
+	wait := retryBaseDelay
+	for i := 1; i < attempt && wait < maxRetryDelay; i++ {
+		wait *= 2
+	}
+	wait = min(wait, maxRetryDelay)
+	if wait > 1 {
+		wait += rand.N(wait / 2)
+	}
+	return wait
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoRequestWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		retries      int
+		wantStatus   int
+		wantAttempts int
+		wantErr      string
+	}{
+		{name: "503 then 200", statusCodes: []int{503, 200}, retries: 3, wantStatus: 200, wantAttempts: 2},
+		{name: "always 503", statusCodes: []int{503}, retries: 3, wantAttempts: 4, wantErr: "giving up after 4 attempts: unexpected status code 503"},
+		{name: "always 503 without retries", statusCodes: []int{503}, retries: 0, wantAttempts: 1, wantErr: "unexpected status code 503"},
+		{name: "400 isn't retried", statusCodes: []int{400}, retries: 3, wantStatus: 400, wantAttempts: 1},
+	}
+
+	baseDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = baseDelay })
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The last status code answers every remaining attempt
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.statusCodes[min(attempts, len(test.statusCodes)-1)])
+				attempts++
+			}))
+			defer server.Close()
+
+			newRequest := func() (*http.Request, error) {
+				return http.NewRequest("POST", server.URL, nil)
+			}
+			resp, err := doRequestWithRetry(server.Client(), newRequest, "test", test.retries)
+			checkError(t, err, test.wantErr)
+			if test.retries == 0 && err != nil && strings.Contains(err.Error(), "giving up") {
+				t.Errorf("a request without retries was wrapped: %v", err)
+			}
+			if resp != nil {
+				resp.Body.Close()
+				if resp.StatusCode != test.wantStatus {
+					t.Errorf("got status %d, want %d", resp.StatusCode, test.wantStatus)
+				}
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{attempt: 1, min: time.Second, max: 1500 * time.Millisecond},
+		{attempt: 3, min: 4 * time.Second, max: 6 * time.Second},
+		{attempt: 20, min: maxRetryDelay, max: maxRetryDelay * 3 / 2},
+		// Past the bits of a Duration the plain shift would overflow
+		{attempt: 100, min: maxRetryDelay, max: maxRetryDelay * 3 / 2},
+	}
+
+	for _, test := range tests {
+		if got := retryDelay(test.attempt); got < test.min || got > test.max {
+			t.Errorf("retryDelay(%d) = %s, want between %s and %s", test.attempt, got, test.min, test.max)
+		}
+	}
+}
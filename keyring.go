@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/zalando/go-keyring"
+)
+
+// getSecret returns the value of a secret. When KEYRING_SERVICE is set
+// the secret is looked up in the OS keyring under that service, with
+// the environment variable name as the user. If the keyring is not
+// available or doesn't have it, the environment variable is used.
+func getSecret(name string) string {
+	service := os.Getenv("KEYRING_SERVICE")
+	if service == "" {
+		return os.Getenv(name)
+	}
+
+	secret, err := keyring.Get(service, name)
+	if err == nil {
+		return secret
+	}
+	if !errors.Is(err, keyring.ErrNotFound) {
+		log.Printf("error reading %s from the keyring, using the environment: %v", name, err)
+	}
+
+	return os.Getenv(name)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics of the updater. The per-cycle ones describe the last call to
+// updateDNSIfNeeded and are reset at its start, the cumulative ones
+// keep growing for the life of the process. A one-shot run has a
+// single cycle, so both are the same.
+//
+// Per-cycle:
+//   - Start: when the cycle started, the duration is measured from it
+//   - Changed, OldContent, NewContent: whether and how the record changed,
+//     the contents of several records are comma-separated
+//   - Reaffirmed: whether FORCE_UPDATE edited the record with the
+//     content it already had
+//   - APICalls: requests done during the cycle
+//   - Latencies: duration of every request of the cycle, by endpoint
+//
+// Cumulative:
+//   - Runs: cycles started
+//   - Changes: cycles that changed the record
+//   - Reaffirms: cycles that reaffirmed the record
+//   - TotalAPICalls: requests done, including outside the cycles
+//
+// All the fields are guarded by mu, the methods can be called from
+// several goroutines.
+type RunMetrics struct {
+	mu sync.Mutex
+
+	Start      time.Time
+	Changed    bool
+	OldContent string
+	NewContent string
+	Reaffirmed bool
+	APICalls   int
+	Latencies  map[string][]time.Duration
+
+	Runs          int
+	Changes       int
+	Reaffirms     int
+	TotalAPICalls int
+
+	// Whether to log the duration of each request
+	Debug bool
+}
+
+var metrics = &RunMetrics{Start: time.Now(), Latencies: map[string][]time.Duration{}}
+
+// resetCycle resets the per-cycle metrics and counts a new run
+func (m *RunMetrics) resetCycle() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Start = time.Now()
+	m.Changed = false
+	m.OldContent = ""
+	m.NewContent = ""
+	m.Reaffirmed = false
+	m.APICalls = 0
+	m.Latencies = map[string][]time.Duration{}
+	m.Runs++
+}
+
+// setContent records the content of a record before and after the
+// cycle, counting a change when they differ. It's called once per
+// record, the cycle changed when any of its records changed.
+func (m *RunMetrics) setContent(oldContent, newContent string, changed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.OldContent != "" || m.NewContent != "" {
+		oldContent = m.OldContent + "," + oldContent
+		newContent = m.NewContent + "," + newContent
+	}
+	m.OldContent = oldContent
+	m.NewContent = newContent
+	if changed && !m.Changed {
+		m.Changes++
+		m.Changed = true
+	}
+}
+
+// setReaffirmed records a forced edit that didn't change the content
+func (m *RunMetrics) setReaffirmed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.Reaffirmed {
+		m.Reaffirms++
+	}
+	m.Reaffirmed = true
+}
+
+func (m *RunMetrics) recordRequest(endpoint string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.APICalls++
+	m.TotalAPICalls++
+	m.Latencies[endpoint] = append(m.Latencies[endpoint], elapsed)
+}
+
+// doRequest does the request, counting it as an API call and recording
+// its duration under the endpoint label. The duration covers the
+// response headers, reading the body is not included. The body is
+// limited to MAX_RESPONSE_BYTES.
+func doRequest(client *http.Client, req *http.Request, endpoint string) (*http.Response, error) {
+	start := time.Now()
+	resp, err := client.Do(req)
+	elapsed := time.Since(start)
+
+	metrics.recordRequest(endpoint, elapsed)
+	if metrics.Debug {
+		log.Printf("%s request to %s took %s", endpoint, req.URL.Host, elapsed.Round(time.Millisecond))
+	}
+
+	if resp != nil {
+		resp.Body = newLimitedBody(resp.Body, maxResponseBytes)
+	}
+
+	return resp, err
+}
+
+// summary returns the per-cycle metrics as a single parseable line, like
+// "porkbun_updater: changed=1 reaffirmed=0 old=1.2.3.4 new=5.6.7.8 duration=420ms api_calls=3 ipify_latency=80ms"
+// The latency of an endpoint is the total of all its requests.
+func (m *RunMetrics) summary() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "porkbun_updater: changed=%d reaffirmed=%d old=%s new=%s duration=%s api_calls=%d",
+		boolToInt(m.Changed), boolToInt(m.Reaffirmed), orDash(m.OldContent), orDash(m.NewContent), time.Since(m.Start).Round(time.Millisecond), m.APICalls)
+
+	for _, endpoint := range m.endpoints() {
+		var total time.Duration
+		for _, latency := range m.Latencies[endpoint] {
+			total += latency
+		}
+		fmt.Fprintf(&b, " %s_latency=%s", endpoint, total.Round(time.Millisecond))
+	}
+
+	return b.String()
+}
+
+// endpoints returns the endpoints with latencies, sorted. m.mu must be
+// held.
+func (m *RunMetrics) endpoints() []string {
+	endpoints := make([]string, 0, len(m.Latencies))
+	for endpoint := range m.Latencies {
+		endpoints = append(endpoints, endpoint)
+	}
+	slices.Sort(endpoints)
+	return endpoints
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Upper bounds, in seconds, of the request duration histogram buckets
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// writeOpenMetrics writes the metrics to path in the OpenMetrics text
+// format, which the node_exporter textfile collector also reads. The
+// per-cycle metrics are gauges and the cumulative ones counters. The
+// file is replaced atomically so a scrape never sees a partial file.
+// runErr tells whether the cycle failed.
+func (m *RunMetrics) writeOpenMetrics(path string, runErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeGauge := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(value))
+	}
+	writeCounter := func(name, help string, value int) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s_total %d\n", name, help, name, name, value)
+	}
+
+	writeGauge("porkbun_updater_success", "Whether the last run succeeded.", float64(boolToInt(runErr == nil)))
+	writeGauge("porkbun_updater_changed", "Whether the last run changed the record.", float64(boolToInt(m.Changed)))
+	writeGauge("porkbun_updater_reaffirmed", "Whether the last run edited the record with the content it already had.", float64(boolToInt(m.Reaffirmed)))
+	writeGauge("porkbun_updater_last_run_timestamp_seconds", "Unix time of the last run.", float64(m.Start.Unix()))
+	writeGauge("porkbun_updater_run_duration_seconds", "Duration of the last run.", time.Since(m.Start).Seconds())
+	writeGauge("porkbun_updater_api_calls", "Requests done by the last run.", float64(m.APICalls))
+
+	writeCounter("porkbun_updater_runs", "Runs started by the process.", m.Runs)
+	writeCounter("porkbun_updater_changes", "Runs that changed the record.", m.Changes)
+	writeCounter("porkbun_updater_reaffirms", "Runs that edited the record with the content it already had.", m.Reaffirms)
+	writeCounter("porkbun_updater_requests", "Requests done by the process.", m.TotalAPICalls)
+
+	const histogram = "porkbun_updater_request_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Duration of the requests of the last run, by endpoint.\n# TYPE %s histogram\n", histogram, histogram)
+
+	for _, endpoint := range m.endpoints() {
+		latencies := m.Latencies[endpoint]
+
+		var sum float64
+		for _, latency := range latencies {
+			sum += latency.Seconds()
+		}
+
+		for _, bucket := range latencyBuckets {
+			count := 0
+			for _, latency := range latencies {
+				if latency.Seconds() <= bucket {
+					count++
+				}
+			}
+			fmt.Fprintf(&b, "%s_bucket{endpoint=%q,le=%q} %d\n", histogram, endpoint, formatFloat(bucket), count)
+		}
+		fmt.Fprintf(&b, "%s_bucket{endpoint=%q,le=\"+Inf\"} %d\n", histogram, endpoint, len(latencies))
+		fmt.Fprintf(&b, "%s_sum{endpoint=%q} %s\n", histogram, endpoint, formatFloat(sum))
+		fmt.Fprintf(&b, "%s_count{endpoint=%q} %d\n", histogram, endpoint, len(latencies))
+	}
+
+	b.WriteString("# EOF\n")
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("error writing the metrics file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("error writing the metrics file: %w", err)
+	}
+
+	return nil
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
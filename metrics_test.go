@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	m := &RunMetrics{Start: time.Now(), Latencies: map[string][]time.Duration{}}
+
+	// A first cycle that changed the record, and a second one that
+	// reaffirmed it, so the counters differ from the gauges
+	m.resetCycle()
+	m.recordRequest("porkbun_retrieve", 80*time.Millisecond)
+	m.setContent("203.0.113.10", "203.0.113.20", true)
+
+	m.resetCycle()
+	m.recordRequest("ipify", 30*time.Millisecond)
+	m.recordRequest("porkbun_retrieve", 200*time.Millisecond)
+	m.recordRequest("porkbun_retrieve", 3*time.Second)
+	m.setContent("203.0.113.20", "203.0.113.20", false)
+	m.setReaffirmed()
+
+	path := filepath.Join(t.TempDir(), "porkbun_updater.prom")
+	if err := m.writeOpenMetrics(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "\n# EOF\n") {
+		t.Errorf("the file doesn't end with # EOF:\n%s", data)
+	}
+
+	families := parseOpenMetrics(t, string(data))
+
+	// expfmt has no OpenMetrics parser, the text one reads the _total
+	// samples as untyped families of their own
+	for name, want := range map[string]float64{
+		"porkbun_updater_runs_total":      2,
+		"porkbun_updater_changes_total":   1,
+		"porkbun_updater_reaffirms_total": 1,
+		"porkbun_updater_requests_total":  4,
+	} {
+		family, ok := families[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		counter := strings.TrimSuffix(name, "_total")
+		if !strings.Contains(string(data), "# TYPE "+counter+" counter\n") {
+			t.Errorf("%s isn't declared as a counter", counter)
+		}
+		if got := family.GetMetric()[0].GetUntyped().GetValue(); got != want {
+			t.Errorf("%s is %v, want %v", name, got, want)
+		}
+	}
+
+	for name, want := range map[string]float64{
+		"porkbun_updater_success":    1,
+		"porkbun_updater_changed":    0,
+		"porkbun_updater_reaffirmed": 1,
+		"porkbun_updater_api_calls":  3,
+	} {
+		family, ok := families[name]
+		if !ok || family.GetType() != dto.MetricType_GAUGE {
+			t.Errorf("missing gauge %s", name)
+			continue
+		}
+		if got := family.GetMetric()[0].GetGauge().GetValue(); got != want {
+			t.Errorf("%s is %v, want %v", name, got, want)
+		}
+	}
+
+	histogram, ok := families["porkbun_updater_request_duration_seconds"]
+	if !ok || histogram.GetType() != dto.MetricType_HISTOGRAM {
+		t.Fatal("missing histogram porkbun_updater_request_duration_seconds")
+	}
+
+	// Only the requests of the last cycle, cumulative by bucket
+	wantBuckets := map[string]map[float64]uint64{
+		"ipify":            {0.05: 1, 0.1: 1, 0.25: 1, 2.5: 1, 5: 1, 30: 1},
+		"porkbun_retrieve": {0.05: 0, 0.1: 0, 0.25: 1, 2.5: 1, 5: 2, 30: 2},
+	}
+	for _, metric := range histogram.GetMetric() {
+		endpoint := metric.GetLabel()[0].GetValue()
+		want, ok := wantBuckets[endpoint]
+		if !ok {
+			t.Errorf("unexpected endpoint %q in the histogram", endpoint)
+			continue
+		}
+		delete(wantBuckets, endpoint)
+
+		// The parser keeps the +Inf bucket
+		buckets := metric.GetHistogram().GetBucket()
+		if len(buckets) != len(latencyBuckets)+1 {
+			t.Errorf("%s has %d buckets, want %d", endpoint, len(buckets), len(latencyBuckets)+1)
+		}
+		for _, bucket := range buckets {
+			if count, ok := want[bucket.GetUpperBound()]; ok && bucket.GetCumulativeCount() != count {
+				t.Errorf("%s bucket le=%v is %d, want %d", endpoint, bucket.GetUpperBound(), bucket.GetCumulativeCount(), count)
+			}
+		}
+		if got := metric.GetHistogram().GetSampleCount(); got != uint64(want[30]) {
+			t.Errorf("%s count is %d, want %d", endpoint, got, want[30])
+		}
+	}
+	for endpoint := range wantBuckets {
+		t.Errorf("missing endpoint %q in the histogram", endpoint)
+	}
+}
+
+func TestWriteOpenMetricsFailedRun(t *testing.T) {
+	m := &RunMetrics{Start: time.Now(), Latencies: map[string][]time.Duration{}}
+	m.resetCycle()
+
+	path := filepath.Join(t.TempDir(), "porkbun_updater.prom")
+	if err := m.writeOpenMetrics(path, errors.New("no IP provider answered")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	families := parseOpenMetrics(t, string(data))
+	if got := families["porkbun_updater_success"].GetMetric()[0].GetGauge().GetValue(); got != 0 {
+		t.Errorf("porkbun_updater_success is %v, want 0", got)
+	}
+}
+
+// parseOpenMetrics decodes the metric families of the OpenMetrics text,
+// by name
+func parseOpenMetrics(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	decoder := expfmt.NewDecoder(strings.NewReader(text), expfmt.NewFormat(expfmt.TypeOpenMetrics))
+	families := map[string]*dto.MetricFamily{}
+	for {
+		family := &dto.MetricFamily{}
+		err := decoder.Decode(family)
+		if errors.Is(err, io.EOF) {
+			return families
+		}
+		if err != nil {
+			t.Fatalf("error parsing the metrics: %v\n%s", err, text)
+		}
+		families[family.GetName()] = family
+	}
+}
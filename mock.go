@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Content of the mocked record before the run
+const mockRecordContent = "203.0.113.10"
+
+// mockTransport fakes Porkbun, ipify, Twilio and GitHub in-process, so
+// the updater runs end-to-end with no network. Writes are only logged.
+type mockTransport struct {
+	publicIP string
+
+	mu      sync.Mutex
+	content string
+}
+
+func newMockTransport(publicIP string) *mockTransport {
+	return &mockTransport{publicIP: publicIP, content: mockRecordContent}
+}
+
+// mockConfig fills the settings a demo doesn't have with fake values,
+// and keeps the run from touching the state file or the channels that
+// don't go through HTTP
+func mockConfig(config PorkbunConfig) PorkbunConfig {
+	config.APIKey = "pk1_mock"
+	config.SecretKey = "sk1_mock"
+	config.RecordID = "1"
+	config.RecordIDs = nil
+	config.RecordNames = nil
+	config.Domain = "example.com"
+	config.RecordName = "home"
+	config.RecordType = "A"
+	config.StateFile = ""
+	config.TrustCache = false
+	config.CurrentIPSources = []string{"api"}
+	config.DesktopNotify = false
+	config.NotifyOrder = []string{"sms"}
+	config.NotifyCooldowns = nil
+	config.Mock = true
+	return config
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case req.URL.Host == "api.ipify.org":
+		return mockResponse(req, http.StatusOK, t.publicIP), nil
+
+	case (req.URL.Host == "api.porkbun.com" || req.URL.Host == "api-ipv4.porkbun.com") && strings.HasSuffix(req.URL.Path, "/ping"):
+		ping, _ := json.Marshal(PorkbunResponse{Status: "SUCCESS", YourIP: t.publicIP})
+		return mockResponse(req, http.StatusOK, string(ping)), nil
+
+	case req.URL.Host == "api.porkbun.com" && strings.Contains(req.URL.Path, "/dns/retrieve/"):
+		records, _ := json.Marshal(PorkbunResponse{
+			Status: "SUCCESS",
+			Records: []Record{{
+				ID:      "1",
+				Name:    "home.example.com",
+				Type:    "A",
+				Content: flexString(t.content),
+				TTL:     "600",
+			}},
+		})
+		// Logged so a run without a change still shows what was compared
+		log.Printf("mock: the A record home.example.com is %s, the public IP is %s", t.content, t.publicIP)
+		return mockResponse(req, http.StatusOK, string(records)), nil
+
+	case req.URL.Host == "api.porkbun.com" && strings.Contains(req.URL.Path, "/dns/edit/"):
+		var edit map[string]string
+		if err := json.Unmarshal([]byte(body), &edit); err != nil {
+			return mockResponse(req, http.StatusBadRequest, `{"status":"ERROR","message":"invalid JSON"}`), nil
+		}
+		record := req.URL.Path[strings.Index(req.URL.Path, "/dns/edit/")+len("/dns/edit/"):]
+		log.Printf("mock: would set the %s record %s from %s to %s", edit["type"], record, t.content, edit["content"])
+		t.content = edit["content"]
+		return mockResponse(req, http.StatusOK, `{"status":"SUCCESS"}`), nil
+
+	case req.URL.Host == "api.twilio.com":
+		form, _ := url.ParseQuery(body)
+		log.Printf("mock: would send the SMS %q", form.Get("Body"))
+		return mockResponse(req, http.StatusCreated, `{}`), nil
+
+	case req.URL.Host == "api.github.com":
+		return mockResponse(req, http.StatusOK, `{"tag_name":"v0.0.1","html_url":"https://github.com/m0r4a/porkbun_IP_updater/releases"}`), nil
+	}
+
+	return mockResponse(req, http.StatusNotFound, fmt.Sprintf("no mock for %s %s", req.Method, req.URL)), nil
+}
+
+func mockResponse(req *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MQTTConfig struct {
+	Broker   string
+	Topic    string
+	Username string
+	Password string
+}
+
+func loadMQTTConfig() MQTTConfig {
+	return MQTTConfig{
+		Broker:   os.Getenv("MQTT_BROKER"),
+		Topic:    os.Getenv("MQTT_TOPIC"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: getSecret("MQTT_PASSWORD"),
+	}
+}
+
+// Event published to MQTT_TOPIC/events when the record changes
+type changeEvent struct {
+	Domain string    `json:"domain"`
+	Name   string    `json:"name"`
+	Old    string    `json:"old"`
+	New    string    `json:"new"`
+	Time   time.Time `json:"time"`
+}
+
+// publishMQTT publishes the current content of the record as a retained
+// message to MQTT_TOPIC, so Home Assistant always has the latest value,
+// and a change event to MQTT_TOPIC/events when it changed. It does
+// nothing unless MQTT_BROKER and MQTT_TOPIC are set. A broker that can't
+// be reached is only logged, it never fails the run.
+func publishMQTT(config PorkbunConfig, oldContent, newContent string, changed bool) {
+	mqttConfig := loadMQTTConfig()
+	if mqttConfig.Broker == "" || mqttConfig.Topic == "" {
+		return
+	}
+	// Each record of a multi-record run gets its own topic
+	if config.RecordLabel != "" {
+		mqttConfig.Topic += "/" + config.RecordLabel
+	}
+	if config.Mock {
+		log.Printf("mock: would publish %s to %s on %s", newContent, mqttConfig.Topic, mqttConfig.Broker)
+		return
+	}
+
+	if err := mqttConfig.publish(config, oldContent, newContent, changed); err != nil {
+		log.Printf("error publishing to MQTT: %v", err)
+	}
+}
+
+func (c MQTTConfig) publish(config PorkbunConfig, oldContent, newContent string, changed bool) error {
+	options := mqtt.NewClientOptions().
+		AddBroker(c.Broker).
+		SetClientID(fmt.Sprintf("porkbun-updater-%d", os.Getpid())).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetConnectTimeout(10 * time.Second)
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if !token.WaitTimeout(15*time.Second) || token.Error() != nil {
+		return fmt.Errorf("error connecting to %s: %v", c.Broker, token.Error())
+	}
+	defer client.Disconnect(250)
+
+	if err := c.send(client, c.Topic, true, newContent); err != nil {
+		return err
+	}
+
+	if changed {
+		event, err := json.Marshal(changeEvent{
+			Domain: config.Domain,
+			Name:   recordFQDN(config),
+			Old:    oldContent,
+			New:    newContent,
+			Time:   time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("error creating the JSON: %w", err)
+		}
+		if err := c.send(client, c.Topic+"/events", false, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c MQTTConfig) send(client mqtt.Client, topic string, retained bool, payload any) error {
+	token := client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		return fmt.Errorf("error publishing to %s: %v", topic, token.Error())
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notifier sends a notification through a channel
+type Notifier interface {
+	Notify(message string) error
+}
+
+// NotifierFunc adapts a function to a Notifier
+type NotifierFunc func(message string) error
+
+func (f NotifierFunc) Notify(message string) error {
+	return f(message)
+}
+
+type notificationChannel struct {
+	// Environment variable with the cooldown of the channel
+	CooldownEnv string
+
+	Enabled  func(config PorkbunConfig) bool
+	Notifier Notifier
+	// Missing returns the required settings that aren't set, and how
+	// many settings the channel requires
+	Missing func() (missing []string, total int)
+}
+
+// Every notification channel by name, NOTIFY_ORDER refers to these names
+var notificationChannels = map[string]notificationChannel{
+	"sms": {
+		CooldownEnv: "TWILIO_COOLDOWN",
+		Enabled:     func(PorkbunConfig) bool { return true },
+		Notifier: NotifierFunc(func(message string) error {
+			if err := SendSMS(message); err != nil {
+				return fmt.Errorf("error sending the SMS: %w", err)
+			}
+			return nil
+		}),
+		Missing: func() ([]string, int) {
+			return loadTwilioConfig().missingFields(), 4
+		},
+	},
+	"webhook": {
+		CooldownEnv: "WEBHOOK_COOLDOWN",
+		Enabled:     func(PorkbunConfig) bool { return true },
+		Notifier:    NotifierFunc(SendWebhook),
+		Missing: func() ([]string, int) {
+			if getSecret("NOTIFY_WEBHOOK_URL") == "" {
+				return []string{"NOTIFY_WEBHOOK_URL"}, 1
+			}
+			return nil, 1
+		},
+	},
+	"desktop": {
+		CooldownEnv: "DESKTOP_COOLDOWN",
+		Enabled:     func(config PorkbunConfig) bool { return config.DesktopNotify && hasDesktopSession() },
+		Notifier:    NotifierFunc(SendDesktop),
+		Missing:     func() ([]string, int) { return nil, 0 },
+	},
+}
+
+var defaultNotifyOrder = []string{"sms", "webhook", "desktop"}
+
+// Channel selected by each NOTIFY_METHOD value
+var notifyMethods = map[string]string{
+	"twilio":  "sms",
+	"webhook": "webhook",
+}
+
+// parseNotifyOrder parses the comma separated NOTIFY_ORDER. Channels
+// left out of it are tried after the listed ones, in the default order.
+func parseNotifyOrder(value string) ([]string, error) {
+	var order []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := notificationChannels[name]; !ok {
+			return nil, fmt.Errorf("unknown notification channel %q in NOTIFY_ORDER", name)
+		}
+		if !slices.Contains(order, name) {
+			order = append(order, name)
+		}
+	}
+
+	for _, name := range defaultNotifyOrder {
+		if !slices.Contains(order, name) {
+			order = append(order, name)
+		}
+	}
+
+	return order, nil
+}
+
+// applyNotifyMethod keeps only the channel selected by NOTIFY_METHOD,
+// which must be fully configured, and the desktop one that has its own
+// DESKTOP_NOTIFY switch. When it's unset or "none", no SMS or webhook
+// is ever sent, whatever else is configured.
+func applyNotifyMethod(order []string, method string) ([]string, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+
+	var name string
+	if method != "" && method != "none" {
+		var ok bool
+		name, ok = notifyMethods[method]
+		if !ok {
+			return nil, fmt.Errorf("invalid NOTIFY_METHOD value %q, expected none, twilio or webhook", method)
+		}
+		if missing, _ := notificationChannels[name].Missing(); len(missing) > 0 {
+			return nil, fmt.Errorf("NOTIFY_METHOD=%s is missing %s", method, strings.Join(missing, ", "))
+		}
+	}
+
+	return slices.DeleteFunc(order, func(channel string) bool {
+		return channel != name && channel != "desktop"
+	}), nil
+}
+
+// checkNotificationChannels drops the channels that aren't configured
+// at all. A partially configured channel is dropped when NOTIFY_PARTIAL
+// is "disable" (the default) or makes the configuration fail when it's
+// "fail", so it never produces a broken request on every run.
+func checkNotificationChannels(order []string, partial string) ([]string, error) {
+	partial = strings.ToLower(partial)
+	if partial == "" {
+		partial = "disable"
+	}
+	if partial != "disable" && partial != "fail" {
+		return nil, fmt.Errorf("invalid NOTIFY_PARTIAL value %q, expected disable or fail", partial)
+	}
+
+	var usable []string
+	for _, name := range order {
+		missing, total := notificationChannels[name].Missing()
+		switch {
+		case len(missing) == 0:
+			usable = append(usable, name)
+		case len(missing) == total:
+			// Not configured at all
+		case partial == "fail":
+			return nil, fmt.Errorf("the %s notification channel is missing %s", name, strings.Join(missing, ", "))
+		default:
+			log.Printf("disabling the %s notification channel, missing %s", name, strings.Join(missing, ", "))
+		}
+	}
+
+	return usable, nil
+}
+
+// loadNotifyCooldowns reads the cooldown of every channel that has one
+func loadNotifyCooldowns() (map[string]time.Duration, error) {
+	cooldowns := map[string]time.Duration{}
+	for name, channel := range notificationChannels {
+		cooldown, err := getEnvDuration(channel.CooldownEnv)
+		if err != nil {
+			return nil, err
+		}
+		if cooldown > 0 {
+			cooldowns[name] = cooldown
+		}
+	}
+	return cooldowns, nil
+}
+
+// enabledChannels returns the channels of NOTIFY_ORDER a notification
+// is sent through
+func enabledChannels(config PorkbunConfig) []string {
+	var enabled []string
+	for _, name := range config.NotifyOrder {
+		if notificationChannels[name].Enabled(config) {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+// notify sends the message through every enabled notification channel,
+// in NOTIFY_ORDER, or only logs it in a dry run. All of them are tried
+// even if one fails. Failures are only logged unless
+// FAIL_ON_NOTIFY_ERROR is enabled, in which case they are returned so
+// the run exits with an error.
+//
+// A channel that already sent a notification within its cooldown is
+// skipped. The send times are kept in the state, which is saved when
+// it changes. With a nil state the cooldowns are ignored.
+func notify(config PorkbunConfig, state *State, message string) error {
+	if config.DryRun {
+		log.Printf("dry run: would notify %q", message)
+		return nil
+	}
+
+	var errs []error
+	sent := false
+
+	for _, name := range enabledChannels(config) {
+		channel := notificationChannels[name]
+
+		if state != nil {
+			if cooldown := config.NotifyCooldowns[name]; cooldown > 0 && time.Since(state.Channels[name]) < cooldown {
+				log.Printf("skipping the %s notification, the last one was sent less than %s ago", name, cooldown)
+				continue
+			}
+		}
+
+		if err := channel.Notifier.Notify(message); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if state != nil {
+			state.Channels[name] = time.Now()
+			sent = true
+		}
+	}
+
+	if sent {
+		if err := state.save(config.StateFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	err := errors.Join(errs...)
+	if err != nil && !config.FailOnNotifyError {
+		log.Printf("error notifying: %v", err)
+		return nil
+	}
+
+	return err
+}
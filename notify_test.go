@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyNotifyMethod(t *testing.T) {
+	// Every channel is configured, NOTIFY_METHOD alone decides
+	t.Setenv("TWILIO_ACCOUNT_SID", "AC123")
+	t.Setenv("TWILIO_AUTH_TOKEN", "token")
+	t.Setenv("TWILIO_FROM_PHONE", "+15550000000")
+	t.Setenv("TWILIO_TO_PHONE", "+15550000001")
+	t.Setenv("NOTIFY_WEBHOOK_URL", "https://example.com/hook")
+	t.Setenv("KEYRING_SERVICE", "")
+
+	tests := []struct {
+		method  string
+		want    []string
+		wantErr string
+	}{
+		{method: "", want: []string{"desktop"}},
+		{method: "none", want: []string{"desktop"}},
+		{method: "twilio", want: []string{"sms", "desktop"}},
+		{method: "Webhook", want: []string{"webhook", "desktop"}},
+		{method: "email", wantErr: `invalid NOTIFY_METHOD value "email"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			got, err := applyNotifyMethod(slices.Clone(defaultNotifyOrder), test.method)
+			checkError(t, err, test.wantErr)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyNotifyMethodMissingSettings(t *testing.T) {
+	t.Setenv("NOTIFY_WEBHOOK_URL", "")
+	t.Setenv("KEYRING_SERVICE", "")
+
+	if _, err := applyNotifyMethod(slices.Clone(defaultNotifyOrder), "webhook"); err == nil {
+		t.Error("NOTIFY_METHOD=webhook without NOTIFY_WEBHOOK_URL was accepted")
+	}
+}
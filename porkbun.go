@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PorkbunClient does the Porkbun API calls for the record of the
+// configuration. HTTPClient can be replaced, e.g. with one pointing to
+// a test server through Config.APIURL or with a custom RoundTripper.
+type PorkbunClient struct {
+	HTTPClient *http.Client
+	Config     PorkbunConfig
+
+	// Records retrieved by the client, keyed by domain, so every record
+	// of a domain is served from a single retrieve call. It's shared
+	// with the clients made by forRecord.
+	records map[string][]Record
+}
+
+func newPorkbunClient(config PorkbunConfig) *PorkbunClient {
+	return &PorkbunClient{
+		HTTPClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: httpTransport,
+		},
+		Config: config,
+	}
+}
+
+// forRecord returns a client for the record of the configuration that
+// shares the HTTP client and the retrieved records of c
+func (c *PorkbunClient) forRecord(config PorkbunConfig) *PorkbunClient {
+	if c.records == nil {
+		c.records = map[string][]Record{}
+	}
+	return &PorkbunClient{HTTPClient: c.HTTPClient, Config: config, records: c.records}
+}
+
+// RetrieveRecord returns the current content of the record
+func (c *PorkbunClient) RetrieveRecord() (string, error) {
+	records, err := c.domainRecords()
+	if err != nil {
+		return "", err
+	}
+
+	for _, record := range records {
+		if string(record.ID) == c.Config.RecordID {
+			if !strings.EqualFold(record.Type, c.Config.RecordType) {
+				return "", fmt.Errorf("record %s has type %s, not %s, check PORKBUN_RECORD_ID and PORKBUN_RECORD_TYPE", c.Config.RecordID, record.Type, c.Config.RecordType)
+			}
+			return string(record.Content), nil
+		}
+	}
+
+	return "", recordNotFoundError(c.Config, records)
+}
+
+// recordNotFoundError explains why the record is missing. When the name
+// has records of other types, the usual cause is a record type that
+// was never created, like an AAAA next to an existing A record.
+func recordNotFoundError(config PorkbunConfig, records []Record) error {
+	name := recordFQDN(config)
+
+	var otherTypes []string
+	for _, record := range records {
+		if strings.EqualFold(record.Name, name) && !slices.Contains(otherTypes, record.Type) {
+			otherTypes = append(otherTypes, record.Type)
+		}
+	}
+
+	if len(otherTypes) > 0 {
+		return fmt.Errorf("no %s record found for %s, it only has %s records; create it in the Porkbun dashboard and set PORKBUN_RECORD_ID to its ID", config.RecordType, name, strings.Join(otherTypes, ", "))
+	}
+
+	return fmt.Errorf("DNS registers not found: no record with ID %s in %s", config.RecordID, config.Domain)
+}
+
+// domainRecords returns every record of the configured domain. The
+// retrieve call is only done once per domain and client, the following
+// lookups are served from the records already retrieved.
+func (c *PorkbunClient) domainRecords() ([]Record, error) {
+	if records, ok := c.records[c.Config.Domain]; ok {
+		return records, nil
+	}
+
+	var porkbunResp PorkbunResponse
+	if err := c.post(c.Config.APIURL+"dns/retrieve/"+c.Config.Domain, "porkbun_retrieve", nil, c.Config.MaxRetries, &porkbunResp); err != nil {
+		return nil, err
+	}
+
+	if porkbunResp.Status != "SUCCESS" {
+		return nil, fmt.Errorf("API error: %s", porkbunResp.Message)
+	}
+
+	if c.records == nil {
+		c.records = map[string][]Record{}
+	}
+	c.records[c.Config.Domain] = porkbunResp.Records
+	return porkbunResp.Records, nil
+}
+
+// EditRecord sets the content of the record
+func (c *PorkbunClient) EditRecord(content string) error {
+	fields := map[string]string{
+		"name":    c.Config.RecordName,
+		"type":    c.Config.RecordType,
+		"content": content,
+	}
+
+	var apiResponse APIResponse
+	if err := c.post(c.Config.APIURL+"dns/edit/"+c.Config.Domain+"/"+c.Config.RecordID, "porkbun_edit", fields, c.Config.MaxRetries, &apiResponse); err != nil {
+		return err
+	}
+
+	if apiResponse.Status != "SUCCESS" {
+		return fmt.Errorf("API error: %s", apiResponse.Message)
+	}
+
+	return nil
+}
+
+// Ping checks the API keys and returns the IP Porkbun sees the request
+// coming from. For IPv4 it goes through the IPv4-only host of the API,
+// so a dual-stack network still gets its IPv4 address.
+func (c *PorkbunClient) Ping(family int) (string, error) {
+	apiURL := c.Config.APIURL
+	if family == 4 {
+		apiURL = strings.Replace(apiURL, "://api.porkbun.com/", "://api-ipv4.porkbun.com/", 1)
+	}
+
+	// Not retried, the other IP providers are the fallback
+	var porkbunResp PorkbunResponse
+	if err := c.post(apiURL+"ping", "porkbun_ping", nil, 0, &porkbunResp); err != nil {
+		return "", err
+	}
+
+	if porkbunResp.Status != "SUCCESS" {
+		return "", fmt.Errorf("API error: %s", porkbunResp.Message)
+	}
+
+	return porkbunResp.YourIP, nil
+}
+
+// post sends the API keys and the fields to the URL of the API and
+// decodes the answer into result. Network errors and 5xx answers are
+// retried up to retries times.
+func (c *PorkbunClient) post(apiURL, endpoint string, fields map[string]string, retries int, result any) error {
+	requestBody := map[string]string{
+		"secretapikey": c.Config.SecretKey,
+		"apikey":       c.Config.APIKey,
+	}
+	for name, value := range fields {
+		requestBody[name] = value
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return fmt.Errorf("error creating the JSON: %w", err)
+	}
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", apiURL, bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	resp, err := doRequestWithRetry(c.HTTPClient, newRequest, endpoint, retries)
+	if err != nil {
+		return fmt.Errorf("error doing the request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding the answer: %w", err)
+	}
+
+	return nil
+}
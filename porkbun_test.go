@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Request received by the test server
+type testRequest struct {
+	Path   string
+	Fields map[string]string
+}
+
+// newTestPorkbunClient returns a client for the A record 1 of
+// home.example.com that talks to a test server answering every request
+// with the status code and body
+func newTestPorkbunClient(t *testing.T, statusCode int, body string, requests *[]testRequest) *PorkbunClient {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var fields map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		if requests != nil {
+			*requests = append(*requests, testRequest{Path: r.URL.Path, Fields: fields})
+		}
+
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return &PorkbunClient{
+		HTTPClient: server.Client(),
+		Config: PorkbunConfig{
+			APIURL:     server.URL + "/",
+			APIKey:     "pk1_test",
+			SecretKey:  "sk1_test",
+			RecordID:   "1",
+			Domain:     "example.com",
+			RecordName: "home",
+			RecordType: "A",
+		},
+	}
+}
+
+func TestRetrieveRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "success",
+			body: `{"status":"SUCCESS","records":[{"id":"1","name":"home.example.com","type":"A","content":"203.0.113.10","ttl":"600"}]}`,
+			want: "203.0.113.10",
+		},
+		{
+			name: "numeric id",
+			body: `{"status":"SUCCESS","records":[{"id":1,"name":"home.example.com","type":"A","content":"203.0.113.10","ttl":600}]}`,
+			want: "203.0.113.10",
+		},
+		{
+			name:    "error status",
+			body:    `{"status":"ERROR","message":"Invalid API key."}`,
+			wantErr: "API error: Invalid API key.",
+		},
+		{
+			name:    "empty records",
+			body:    `{"status":"SUCCESS","records":[]}`,
+			wantErr: "no record with ID 1 in example.com",
+		},
+		{
+			name:    "unknown record ID",
+			body:    `{"status":"SUCCESS","records":[{"id":"2","name":"www.example.com","type":"A","content":"203.0.113.10"}]}`,
+			wantErr: "no record with ID 1 in example.com",
+		},
+		{
+			name:    "only other types for the name",
+			body:    `{"status":"SUCCESS","records":[{"id":"2","name":"home.example.com","type":"AAAA","content":"2001:db8::1"}]}`,
+			wantErr: "no A record found for home.example.com, it only has AAAA records",
+		},
+		{
+			name:    "wrong type",
+			body:    `{"status":"SUCCESS","records":[{"id":"1","name":"home.example.com","type":"CNAME","content":"example.net"}]}`,
+			wantErr: "record 1 has type CNAME, not A",
+		},
+		{
+			name:    "malformed JSON",
+			body:    `{"status":"SUCCESS","records":[`,
+			wantErr: "error decoding the answer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests []testRequest
+			client := newTestPorkbunClient(t, http.StatusOK, test.body, &requests)
+
+			got, err := client.RetrieveRecord()
+			checkError(t, err, test.wantErr)
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			if requests[0].Path != "/dns/retrieve/example.com" {
+				t.Errorf("request to %s, want /dns/retrieve/example.com", requests[0].Path)
+			}
+			if requests[0].Fields["apikey"] != "pk1_test" || requests[0].Fields["secretapikey"] != "sk1_test" {
+				t.Errorf("request without the API keys: %v", requests[0].Fields)
+			}
+		})
+	}
+}
+
+func TestEditRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantErr    string
+	}{
+		{
+			name:       "success",
+			statusCode: http.StatusOK,
+			body:       `{"status":"SUCCESS"}`,
+		},
+		{
+			name:       "success with empty records",
+			statusCode: http.StatusOK,
+			body:       `{"status":"SUCCESS","records":[]}`,
+		},
+		{
+			name:       "error status",
+			statusCode: http.StatusOK,
+			body:       `{"status":"ERROR","message":"Invalid API key."}`,
+			wantErr:    "API error: Invalid API key.",
+		},
+		{
+			name:       "unknown record ID",
+			statusCode: http.StatusBadRequest,
+			body:       `{"status":"ERROR","message":"Edit error: We were unable to edit the DNS record."}`,
+			wantErr:    "API error: Edit error",
+		},
+		{
+			name:       "wrong type",
+			statusCode: http.StatusBadRequest,
+			body:       `{"status":"ERROR","message":"Invalid type."}`,
+			wantErr:    "API error: Invalid type.",
+		},
+		{
+			name:       "malformed JSON",
+			statusCode: http.StatusOK,
+			body:       `<html>Bad Gateway</html>`,
+			wantErr:    "error decoding the answer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests []testRequest
+			client := newTestPorkbunClient(t, test.statusCode, test.body, &requests)
+
+			checkError(t, client.EditRecord("203.0.113.20"), test.wantErr)
+
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			request := requests[0]
+			if request.Path != "/dns/edit/example.com/1" {
+				t.Errorf("request to %s, want /dns/edit/example.com/1", request.Path)
+			}
+			for name, want := range map[string]string{"name": "home", "type": "A", "content": "203.0.113.20", "apikey": "pk1_test"} {
+				if got := request.Fields[name]; got != want {
+					t.Errorf("%s is %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestForRecordSharesRetrievedRecords(t *testing.T) {
+	var requests []testRequest
+	client := newTestPorkbunClient(t, http.StatusOK, `{"status":"SUCCESS","records":[
+		{"id":"1","name":"home.example.com","type":"A","content":"203.0.113.10"},
+		{"id":"2","name":"www.example.com","type":"A","content":"203.0.113.11"}]}`, &requests)
+
+	www := client.Config
+	www.RecordID = "2"
+	www.RecordName = "www"
+
+	for config, want := range map[*PorkbunConfig]string{&client.Config: "203.0.113.10", &www: "203.0.113.11"} {
+		got, err := client.forRecord(*config).RetrieveRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("record %s is %q, want %q", config.RecordID, got, want)
+		}
+	}
+
+	if len(requests) != 1 {
+		t.Errorf("got %d retrieve requests, want 1", len(requests))
+	}
+
+	// A separate client doesn't see the records of the first one
+	other := newTestPorkbunClient(t, http.StatusOK, `{"status":"SUCCESS","records":[]}`, nil)
+	if _, err := other.RetrieveRecord(); err == nil {
+		t.Error("a separate client was served the records of another one")
+	}
+}
+
+// checkError fails the test unless err contains wantErr, or is nil when
+// wantErr is empty
+func checkError(t *testing.T, err error, wantErr string) {
+	t.Helper()
+
+	switch {
+	case wantErr == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case wantErr != "" && err == nil:
+		t.Errorf("got no error, want %q", wantErr)
+	case wantErr != "" && !strings.Contains(err.Error(), wantErr):
+		t.Errorf("got error %q, want %q", err, wantErr)
+	}
+}
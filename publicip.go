@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type ipProvider struct {
+	// Label of the requests in the metrics
+	Name string
+	URL  string
+}
+
+// Name of the provider that asks the ping endpoint of Porkbun, which
+// answers with the IP Porkbun itself sees
+const porkbunIPProvider = "porkbun"
+
+// IP echo services tried in order when IP_PROVIDERS isn't set, by family
+var defaultIPProviders = map[int][]ipProvider{
+	4: {
+		{Name: porkbunIPProvider},
+		{Name: "ipify", URL: "https://api.ipify.org?format=text"},
+		{Name: "icanhazip", URL: "https://ipv4.icanhazip.com"},
+		{Name: "ifconfig_me", URL: "https://ifconfig.me/ip"},
+	},
+	6: {
+		{Name: porkbunIPProvider},
+		{Name: "ipify", URL: "https://api6.ipify.org?format=text"},
+		{Name: "icanhazip", URL: "https://ipv6.icanhazip.com"},
+		{Name: "ifconfig_me", URL: "https://ifconfig.me/ip"},
+	},
+}
+
+// parseIPProviders reads the comma-separated URLs of the environment
+// variable, where "porkbun" is the ping endpoint of Porkbun
+func parseIPProviders(name string) ([]string, error) {
+	var providers []string
+	for _, provider := range strings.Split(os.Getenv(name), ",") {
+		provider = strings.TrimSpace(provider)
+		if provider == "" {
+			continue
+		}
+		if strings.EqualFold(provider, porkbunIPProvider) {
+			providers = append(providers, porkbunIPProvider)
+			continue
+		}
+		parsed, err := url.Parse(provider)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid URL %q in %s, expected an http or https URL or porkbun", provider, name)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// ipFamily returns the IP family the record is updated with, 6 for AAAA
+// records and 4 for anything else
+func ipFamily(recordType string) int {
+	if recordType == "AAAA" {
+		return 6
+	}
+	return 4
+}
+
+// ipProviders returns the IP echo services of the family, the ones of
+// IP_PROVIDERS (IP_PROVIDERS_V6 for IPv6) when set
+func ipProviders(config PorkbunConfig, family int) []ipProvider {
+	urls := config.IPProviders
+	if family == 6 {
+		urls = config.IPProvidersV6
+	}
+	if len(urls) == 0 {
+		return defaultIPProviders[family]
+	}
+
+	providers := make([]ipProvider, len(urls))
+	for i, providerURL := range urls {
+		if providerURL == porkbunIPProvider {
+			providers[i] = ipProvider{Name: porkbunIPProvider}
+			continue
+		}
+		providers[i] = ipProvider{Name: "ip_provider", URL: providerURL}
+	}
+	return providers
+}
+
+// getPublicIP asks the IP providers for the public IP of the family,
+// trying them in order until one answers with an IP of that family. By
+// default Porkbun itself is asked first, so the record gets the address
+// Porkbun sees even behind a NAT that ipify sees differently. If all of
+// them fail, the error lists the failure of each one.
+func getPublicIP(config PorkbunConfig, family int) (string, error) {
+	var failures []string
+	for _, provider := range ipProviders(config, family) {
+		var ip string
+		var err error
+		if provider.Name == porkbunIPProvider {
+			ip, err = pingPorkbun(config, family)
+		} else {
+			ip, err = queryIPProvider(config, provider, family)
+		}
+		if err == nil {
+			return ip, nil
+		}
+		failures = append(failures, err.Error())
+	}
+
+	return "", fmt.Errorf("no IP provider answered: %s", strings.Join(failures, "; "))
+}
+
+// queryIPProvider asks a single IP echo service for the public IP.
+// Redirects are only followed up to IP_MAX_REDIRECTS (none by default)
+// and the final body has to be a valid IP, so a hijacked or redirected
+// service can't feed an HTML page into the record.
+func queryIPProvider(config PorkbunConfig, provider ipProvider, family int) (string, error) {
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: httpTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > config.IPMaxRedirects {
+				return fmt.Errorf("redirect to %s not allowed, IP_MAX_REDIRECTS is %d", req.URL.Host, config.IPMaxRedirects)
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", provider.URL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doRequest(client, req, provider.Name)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, resp.Request.URL.Host)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading the answer of %s: %w", resp.Request.URL.Host, err)
+	}
+
+	ip := strings.TrimSpace(string(body))
+	if err := checkProviderIP(resp.Request.URL.Host, ip, family); err != nil {
+		return "", err
+	}
+
+	return ip, nil
+}
+
+// pingPorkbun asks the ping endpoint of Porkbun for the public IP
+func pingPorkbun(config PorkbunConfig, family int) (string, error) {
+	ip, err := newPorkbunClient(config).Ping(family)
+	if err != nil {
+		return "", fmt.Errorf("porkbun ping: %w", err)
+	}
+
+	if err := checkProviderIP("porkbun ping", ip, family); err != nil {
+		return "", err
+	}
+
+	return ip, nil
+}
+
+// checkProviderIP checks that the provider answered with an IP of the
+// family
+func checkProviderIP(provider, ip string, family int) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return fmt.Errorf("%s didn't answer with a valid IP", provider)
+	}
+	if (parsed.To4() != nil) != (family == 4) {
+		return fmt.Errorf("%s answered with %s, not an IPv%d address", provider, ip, family)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueryIPProviderRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("203.0.113.20\n"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ip", http.StatusFound)
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>Rate limited</body></html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		path           string
+		ipMaxRedirects int
+		want           string
+		wantErr        string
+	}{
+		{name: "direct", path: "/ip", want: "203.0.113.20"},
+		{name: "redirect not allowed", path: "/redirect", wantErr: "not allowed, IP_MAX_REDIRECTS is 0"},
+		{name: "redirect allowed", path: "/redirect", ipMaxRedirects: 1, want: "203.0.113.20"},
+		{name: "HTML body", path: "/html", wantErr: "didn't answer with a valid IP"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := PorkbunConfig{IPMaxRedirects: test.ipMaxRedirects}
+			provider := ipProvider{Name: "ip_provider", URL: server.URL + test.path}
+
+			got, err := queryIPProvider(config, provider, 4)
+			checkError(t, err, test.wantErr)
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckProviderIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		family  int
+		wantErr string
+	}{
+		{ip: "203.0.113.20", family: 4},
+		{ip: "2001:db8::1", family: 6},
+		{ip: "2001:db8::1", family: 4, wantErr: "not an IPv4 address"},
+		{ip: "203.0.113.20", family: 6, wantErr: "not an IPv6 address"},
+		{ip: "<html>Bad Gateway</html>", family: 4, wantErr: "didn't answer with a valid IP"},
+	}
+
+	for _, test := range tests {
+		checkError(t, checkProviderIP("provider", test.ip, test.family), test.wantErr)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// State persisted between runs in STATE_FILE
+type State struct {
+	// By record ID
+	Records map[string]*RecordState `json:"records"`
+	// Last notification sent by each channel
+	Channels map[string]time.Time `json:"channels,omitempty"`
+}
+
+type RecordState struct {
+	Content     string    `json:"content"`
+	LastChange  time.Time `json:"last_change"`
+	LastSuccess time.Time `json:"last_success"`
+	// Last time Content was checked against or written to Porkbun
+	LastSync time.Time `json:"last_sync"`
+}
+
+// loadState reads the state file. A missing file or an empty path
+// returns an empty state.
+func loadState(path string) (*State, error) {
+	state := &State{Records: map[string]*RecordState{}, Channels: map[string]time.Time{}}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error decoding the state file: %w", err)
+	}
+	if state.Records == nil {
+		state.Records = map[string]*RecordState{}
+	}
+	if state.Channels == nil {
+		state.Channels = map[string]time.Time{}
+	}
+
+	return state, nil
+}
+
+// save writes the state atomically, so an interrupted run never leaves
+// a truncated file behind. It does nothing when path is empty.
+func (s *State) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding the state: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("error writing the state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("error writing the state file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *State) record(recordID string) *RecordState {
+	recordState, ok := s.Records[recordID]
+	if !ok {
+		recordState = &RecordState{}
+		s.Records[recordID] = recordState
+	}
+	return recordState
+}
+
+// checkRecordAge alerts when the record still hasn't been updated or
+// confirmed within MAX_RECORD_AGE after the update attempt of the run,
+// which means the runs have been failing or not running at all.
+func checkRecordAge(config PorkbunConfig, state *State) error {
+	if config.MaxRecordAge == 0 {
+		return nil
+	}
+
+	recordState, ok := state.Records[config.RecordID]
+	if !ok || recordState.LastSuccess.IsZero() {
+		return nil
+	}
+
+	age := time.Since(recordState.LastSuccess)
+	if age <= config.MaxRecordAge {
+		return nil
+	}
+
+	return notify(config, state, fmt.Sprintf("The DNS record of %s hasn't been updated or confirmed for %s, DDNS may be stuck", config.Domain, age.Round(time.Second)))
+}
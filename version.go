@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+const latestReleaseURL = "https://api.github.com/repos/m0r4a/porkbun_IP_updater/releases/latest"
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// checkUpdate queries the latest GitHub release and returns a message
+// telling whether it's newer than the running version. Nothing is
+// downloaded or installed.
+func checkUpdate() (string, error) {
+	req, err := http.NewRequest("GET", latestReleaseURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating the request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: httpTransport}
+	resp, err := doRequest(client, req, "github")
+	if err != nil {
+		return "", fmt.Errorf("error doing the request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "No releases have been published yet", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error of GitHub's API: status code %d", resp.StatusCode)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("error decoding the answer: %w", err)
+	}
+
+	if version == "dev" {
+		return fmt.Sprintf("Running a development build, the latest release is %s (%s)", release.TagName, release.HTMLURL), nil
+	}
+	if compareVersions(release.TagName, version) > 0 {
+		return fmt.Sprintf("A newer version is available: %s (running %s), see %s", release.TagName, version, release.HTMLURL), nil
+	}
+	return fmt.Sprintf("Running the latest version %s", version), nil
+}
+
+// compareVersions compares two vMAJOR.MINOR.PATCH versions, returning
+// a positive number if a is newer than b, negative if older and 0 if
+// they are equal. Missing or non numeric parts count as 0.
+func compareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+		if numA != numB {
+			return numA - numB
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SendWebhook posts the message as {"content": message} to
+// NOTIFY_WEBHOOK_URL, the format of Discord webhooks
+func SendWebhook(message string) error {
+	body, err := json.Marshal(map[string]string{"content": message})
+	if err != nil {
+		return fmt.Errorf("error creating the JSON: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", getSecret("NOTIFY_WEBHOOK_URL"), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("error creating the request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: httpTransport}
+	resp, err := doRequest(client, req, "webhook")
+	if err != nil {
+		// The URL carries the token of the webhook, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error sending the webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error of the webhook: status code %d", resp.StatusCode)
+	}
+
+	return nil
+}